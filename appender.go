@@ -2,7 +2,9 @@ package vlog
 
 import (
 	"bytes"
+	"io"
 	"os"
+	"reflect"
 	"sync/atomic"
 )
 
@@ -17,11 +19,29 @@ type Appender interface {
 	SetTransformer(transformer Transformer)
 }
 
+// Flusher is implemented by appenders buffering logs, Flush write the buffered logs to destination
+type Flusher interface {
+	Flush() error
+}
+
+// wrapper is implemented by appenders writing logs to another appender
+type wrapper interface {
+	wrappedAppender() Appender
+}
+
 // AppendEvent is a log event passed to Appender
 type AppendEvent struct {
 	LoggerName string
 	Level      Level
-	Message    string // the logger message
+	// the transformed log data. Message may be backed by a buffer reused by logger, it is only valid until Append
+	// returned. Appenders keeping the event after Append returned should copy it by Clone.
+	Message []byte
+}
+
+// Clone return a copy of the event, with Message copied
+func (e AppendEvent) Clone() AppendEvent {
+	e.Message = append([]byte(nil), e.Message...)
+	return e
 }
 
 // CanFormattedMixin used for impl Appender Transformer/Name... methods
@@ -56,7 +76,7 @@ type ConsoleAppender struct {
 
 // Append log to stdout
 func (ca *ConsoleAppender) Append(event AppendEvent) error {
-	_, err := ca.file.WriteString(event.Message)
+	_, err := ca.file.Write(event.Message)
 	return err
 }
 
@@ -77,6 +97,25 @@ func NewConsole2Appender() *ConsoleAppender {
 	return &ConsoleAppender{file: os.Stderr, CanFormattedMixin: NewAppenderMixin()}
 }
 
+// NewColorConsoleAppender create console appender, which write log to stdout, using ConsoleTransformer with default
+// console pattern. Colors are output only when stdout is a terminal and NO_COLOR env is not set.
+func NewColorConsoleAppender() *ConsoleAppender {
+	return newColorConsoleAppender(os.Stdout)
+}
+
+// NewColorConsole2Appender create console appender, which write log to stderr, using ConsoleTransformer with default
+// console pattern. Colors are output only when stderr is a terminal and NO_COLOR env is not set.
+func NewColorConsole2Appender() *ConsoleAppender {
+	return newColorConsoleAppender(os.Stderr)
+}
+
+func newColorConsoleAppender(file *os.File) *ConsoleAppender {
+	appender := &ConsoleAppender{file: file, CanFormattedMixin: NewAppenderMixin()}
+	transformer, _ := NewConsoleTransformer("", file)
+	appender.SetTransformer(transformer)
+	return appender
+}
+
 var _ Appender = (*NopAppender)(nil)
 
 // NopAppender discard all logs
@@ -109,6 +148,79 @@ func NewBytesAppender() *BytesAppender {
 
 // Append write log data to byte buffer
 func (b *BytesAppender) Append(event AppendEvent) error {
-	_, err := b.buffer.WriteString(event.Message)
+	_, err := b.buffer.Write(event.Message)
 	return err
 }
+
+// all appenders used by loggers and the default appender, including appenders wrapped by other appenders.
+// Wrapping appenders are placed before the wrapped ones.
+func allAppenders() []Appender {
+	var appenders []Appender
+	var seen = map[Appender]bool{}
+	var add func(appender Appender)
+	add = func(appender Appender) {
+		if appender == nil {
+			return
+		}
+		// appenders of uncomparable types can not be map keys
+		if reflect.TypeOf(appender).Comparable() {
+			if seen[appender] {
+				return
+			}
+			seen[appender] = true
+		}
+		appenders = append(appenders, appender)
+		if w, ok := appender.(wrapper); ok {
+			add(w.wrappedAppender())
+		}
+	}
+	add(DefaultAppender())
+	for _, logger := range FilterLoggers("") {
+		for _, appender := range logger.Appenders() {
+			add(appender)
+		}
+	}
+	return appenders
+}
+
+// FlushAppenders flush all appenders used by loggers, which implement Flusher.
+// Summaries of samplers set to loggers are logged before flushing.
+// Return the first error occurred, all appenders are flushed even if error occurred.
+func FlushAppenders() error {
+	flushSamplers()
+	var firstErr error
+	for _, appender := range allAppenders() {
+		if flusher, ok := appender.(Flusher); ok {
+			if err := flusher.Flush(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// flush samplers of all loggers, to log summaries of suppressed records
+func flushSamplers() {
+	var seen = map[*Sampler]bool{}
+	for _, logger := range FilterLoggers("") {
+		if sampler := logger.Sampler(); sampler != nil && !seen[sampler] {
+			seen[sampler] = true
+			sampler.Flush()
+		}
+	}
+}
+
+// CloseAppenders flush all appenders used by loggers, and close those implement io.Closer.
+// Call CloseAppenders before process exits, to not lose buffered logs. Logs after closed would be lost.
+// Return the first error occurred, all appenders are closed even if error occurred.
+func CloseAppenders() error {
+	firstErr := FlushAppenders()
+	for _, appender := range allAppenders() {
+		if closer, ok := appender.(io.Closer); ok {
+			if err := closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,244 @@
+package vlog
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errBatcherClosed = errors.New("appender is closed")
+
+// batchEntry is one log event waiting to be sent in batch
+type batchEntry struct {
+	time  time.Time // the time the event was appended
+	event AppendEvent
+}
+
+// batchRequest is a batch of entries passed to send goroutine
+type batchRequest struct {
+	entries []batchEntry
+	flushed chan struct{} // closed when entries are sent, may be nil
+}
+
+// the max count of batches waiting for the send goroutine
+const batchQueueSize = 16
+
+// batcher collect log events into batches, by count, bytes and max latency, and send batches in one goroutine.
+// Batches are sent in the order they are handed off. Appending never waits for sending: if the send goroutine is
+// behind and the queue is full, the batch is passed to overflow, or dropped if overflow is nil or failed.
+// When there is no batch to send for max latency, retry is called in the send goroutine, to resend saved batches.
+type batcher struct {
+	dropped  int64 // the count of dropped events, first field for 64-bit alignment of atomic operations
+	dropping int32 // 1 if the last handed off batch is dropped, to not report every dropped batch
+	send     func(entries []batchEntry)
+	overflow func(entries []batchEntry) bool // return if the entries are saved
+	retry    func()
+
+	lock       sync.Mutex
+	maxCount   int
+	maxBytes   int
+	maxLatency time.Duration
+	entries    []batchEntry
+	bytes      int
+	generation int64 // increased every time the pending entries are handed off, used to ignore stale timers
+	timer      *time.Timer
+	closed     bool
+	senders    sync.WaitGroup // flush calls sending requests, close should wait them before closing requests
+	requests   chan batchRequest
+	closing    chan struct{} // closed when close is called, to stop waiting in send
+	done       chan struct{}
+}
+
+// newBatcher create batcher and start the send goroutine. overflow and retry may be nil.
+func newBatcher(maxCount int, maxBytes int, maxLatency time.Duration, send func(entries []batchEntry),
+	overflow func(entries []batchEntry) bool, retry func()) *batcher {
+	b := &batcher{
+		send:       send,
+		overflow:   overflow,
+		retry:      retry,
+		maxCount:   maxCount,
+		maxBytes:   maxBytes,
+		maxLatency: maxLatency,
+		requests:   make(chan batchRequest, batchQueueSize),
+		closing:    make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+func (b *batcher) loop() {
+	defer close(b.done)
+	for {
+		var timer *time.Timer
+		var idle <-chan time.Time
+		if b.retry != nil {
+			if latency := b.latency(); latency > 0 {
+				timer = time.NewTimer(latency)
+				idle = timer.C
+			}
+		}
+		select {
+		case request, ok := <-b.requests:
+			if timer != nil {
+				timer.Stop()
+			}
+			if !ok {
+				return
+			}
+			if len(request.entries) > 0 {
+				b.send(request.entries)
+			}
+			if request.flushed != nil {
+				close(request.flushed)
+			}
+		case <-idle:
+			b.retry()
+		}
+	}
+}
+
+func (b *batcher) latency() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.maxLatency
+}
+
+// sleep for duration in send goroutine, return false if the batcher is closing and it is waked up early
+func (b *batcher) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-b.closing:
+		return false
+	}
+}
+
+// setLimits set the batch limits. zero or negative value means no limit for this dimension.
+func (b *batcher) setLimits(maxCount int, maxBytes int, maxLatency time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.maxCount = maxCount
+	b.maxBytes = maxBytes
+	b.maxLatency = maxLatency
+}
+
+// add one event. The pending batch is handed off to send goroutine if reach the count or bytes limit.
+func (b *batcher) add(event AppendEvent) error {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return errBatcherClosed
+	}
+	b.entries = append(b.entries, batchEntry{time: time.Now(), event: event.Clone()})
+	b.bytes += len(event.Message)
+	var overflowed []batchEntry
+	if (b.maxCount > 0 && len(b.entries) >= b.maxCount) || (b.maxBytes > 0 && b.bytes >= b.maxBytes) {
+		overflowed = b.handOff()
+	} else if len(b.entries) == 1 && b.maxLatency > 0 {
+		generation := b.generation
+		b.timer = time.AfterFunc(b.maxLatency, func() {
+			var overflowed []batchEntry
+			b.lock.Lock()
+			if b.generation == generation && !b.closed {
+				overflowed = b.handOff()
+			}
+			b.lock.Unlock()
+			b.handleOverflow(overflowed)
+		})
+	}
+	b.lock.Unlock()
+	b.handleOverflow(overflowed)
+	return nil
+}
+
+// take the pending entries. Must be called with lock held.
+func (b *batcher) takeEntries() []batchEntry {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.generation++
+	entries := b.entries
+	b.entries = nil
+	b.bytes = 0
+	return entries
+}
+
+// hand off pending entries to send goroutine without waiting. Return the entries if the queue is full.
+// Must be called with lock held.
+func (b *batcher) handOff() []batchEntry {
+	entries := b.takeEntries()
+	if len(entries) == 0 {
+		return nil
+	}
+	select {
+	case b.requests <- batchRequest{entries: entries}:
+		atomic.StoreInt32(&b.dropping, 0)
+		return nil
+	default:
+		return entries
+	}
+}
+
+// pass entries not handed off to overflow, or drop them
+func (b *batcher) handleOverflow(entries []batchEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	if b.overflow != nil && b.overflow(entries) {
+		return
+	}
+	atomic.AddInt64(&b.dropped, int64(len(entries)))
+	// report once until a batch is handed off again
+	if atomic.CompareAndSwapInt32(&b.dropping, 0, 1) {
+		reportError("log batch dropped", errors.New("send queue is full, "+strconv.Itoa(len(entries))+
+			" events dropped, following drops are not reported until the queue is available"))
+	}
+}
+
+// the count of events dropped as the queue is full
+func (b *batcher) droppedCount() int64 {
+	return atomic.LoadInt64(&b.dropped)
+}
+
+// flush send all pending entries, and wait until they are sent.
+func (b *batcher) flush() {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	entries := b.takeEntries()
+	b.senders.Add(1)
+	b.lock.Unlock()
+
+	flushed := make(chan struct{})
+	b.requests <- batchRequest{entries: entries, flushed: flushed}
+	b.senders.Done()
+	<-flushed
+}
+
+// close send all pending entries, and stop the send goroutine.
+func (b *batcher) close() {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	b.closed = true
+	close(b.closing)
+	entries := b.takeEntries()
+	b.lock.Unlock()
+
+	b.senders.Wait()
+	if len(entries) > 0 {
+		b.requests <- batchRequest{entries: entries}
+	}
+	close(b.requests)
+	<-b.done
+}
@@ -0,0 +1,90 @@
+package vlog
+
+import (
+	"errors"
+	"testing"
+)
+
+// discardAppender discard logs, only count the bytes
+type discardAppender struct {
+	*CanFormattedMixin
+	bytes int
+}
+
+func newDiscardAppender(transformer Transformer) *discardAppender {
+	appender := &discardAppender{CanFormattedMixin: NewAppenderMixin()}
+	appender.SetTransformer(transformer)
+	return appender
+}
+
+func (d *discardAppender) Append(event AppendEvent) error {
+	d.bytes += len(event.Message)
+	return nil
+}
+
+func benchmarkLogger(b *testing.B, transformer Transformer, log func(logger *Logger)) {
+	logger := GetLogger("benchmark/logger")
+	logger.SetAppenders(newDiscardAppender(transformer))
+	logger.SetLevel(Info)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		log(logger)
+	}
+}
+
+func BenchmarkLogger_Info(b *testing.B) {
+	benchmarkLogger(b, NewDefaultPatternTransformer(), func(logger *Logger) {
+		logger.Info("request finished")
+	})
+}
+
+func BenchmarkLogger_InfoArgs(b *testing.B) {
+	benchmarkLogger(b, NewDefaultPatternTransformer(), func(logger *Logger) {
+		logger.Info("request finished", "/api/users", 200, 1.5)
+	})
+}
+
+func BenchmarkLogger_InfoFormat(b *testing.B) {
+	benchmarkLogger(b, NewDefaultPatternTransformer(), func(logger *Logger) {
+		logger.InfoFormat("request {} finished with status {}", "/api/users", 200)
+	})
+}
+
+func BenchmarkLogger_InfoError(b *testing.B) {
+	err := errors.New("connection refused")
+	benchmarkLogger(b, NewDefaultPatternTransformer(), func(logger *Logger) {
+		logger.Info("request failed:", err)
+	})
+}
+
+func BenchmarkLogger_Caller(b *testing.B) {
+	transformer := MustNewPatternTransformer("{time} [{Level|-5}] {package}/{file}:{line} {function} - {message}\n")
+	benchmarkLogger(b, transformer, func(logger *Logger) {
+		logger.Info("request finished")
+	})
+}
+
+func BenchmarkLogger_JSON(b *testing.B) {
+	benchmarkLogger(b, NewJSONTransformer(false), func(logger *Logger) {
+		logger.Info("request finished")
+	})
+}
+
+func BenchmarkLogger_Disabled(b *testing.B) {
+	benchmarkLogger(b, NewDefaultPatternTransformer(), func(logger *Logger) {
+		logger.Debug("request finished", "/api/users", 200)
+	})
+}
+
+func BenchmarkLogger_Parallel(b *testing.B) {
+	logger := GetLogger("benchmark/parallel")
+	logger.SetAppenders(NewNopAppender())
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.InfoFormat("request {} finished with status {}", "/api/users", 200)
+		}
+	})
+}
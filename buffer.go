@@ -0,0 +1,85 @@
+package vlog
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// buffers larger than this are not put back to pool, to avoid holding memory after logging a huge message
+const maxPooledBufferSize = 64 * 1024
+
+// buffer is a reusable byte buffer, get from pool by getBuffer, and should be put back by putBuffer after used
+type buffer struct {
+	b []byte
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &buffer{b: make([]byte, 0, 1024)}
+	},
+}
+
+// get one empty buffer from pool
+func getBuffer() *buffer {
+	return bufferPool.Get().(*buffer)
+}
+
+// put buffer back to pool. The buffer should not be used after put back.
+func putBuffer(buf *buffer) {
+	if cap(buf.b) > maxPooledBufferSize {
+		return
+	}
+	buf.b = buf.b[:0]
+	bufferPool.Put(buf)
+}
+
+// Write implement io.Writer, append data to buffer
+func (buf *buffer) Write(data []byte) (int, error) {
+	buf.b = append(buf.b, data...)
+	return len(data), nil
+}
+
+// appendArg append the text of log arg to buf, same as fmt.Sprint(arg), but without allocation for common types
+func appendArg(buf *buffer, arg interface{}) {
+	switch v := arg.(type) {
+	case string:
+		buf.b = append(buf.b, v...)
+	case int:
+		buf.b = strconv.AppendInt(buf.b, int64(v), 10)
+	case int8:
+		buf.b = strconv.AppendInt(buf.b, int64(v), 10)
+	case int16:
+		buf.b = strconv.AppendInt(buf.b, int64(v), 10)
+	case int32:
+		buf.b = strconv.AppendInt(buf.b, int64(v), 10)
+	case int64:
+		buf.b = strconv.AppendInt(buf.b, v, 10)
+	case uint:
+		buf.b = strconv.AppendUint(buf.b, uint64(v), 10)
+	case uint8:
+		buf.b = strconv.AppendUint(buf.b, uint64(v), 10)
+	case uint16:
+		buf.b = strconv.AppendUint(buf.b, uint64(v), 10)
+	case uint32:
+		buf.b = strconv.AppendUint(buf.b, uint64(v), 10)
+	case uint64:
+		buf.b = strconv.AppendUint(buf.b, v, 10)
+	case float32:
+		buf.b = strconv.AppendFloat(buf.b, float64(v), 'g', -1, 32)
+	case float64:
+		buf.b = strconv.AppendFloat(buf.b, v, 'g', -1, 64)
+	case bool:
+		buf.b = strconv.AppendBool(buf.b, v)
+	case time.Duration:
+		buf.b = append(buf.b, v.String()...)
+	case nil:
+		buf.b = append(buf.b, "<nil>"...)
+	case Redactable:
+		buf.b = append(buf.b, v.Redacted()...)
+	default:
+		// errors and Stringers with nil receiver may panic, let fmt handle them
+		_, _ = fmt.Fprint(buf, v)
+	}
+}
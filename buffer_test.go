@@ -0,0 +1,40 @@
+package vlog
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nilStringer struct{ name string }
+
+func (s *nilStringer) String() string {
+	return s.name
+}
+
+func TestAppendArg(t *testing.T) {
+	var ns *nilStringer
+	args := []interface{}{"str", 1, int8(-2), int16(3), int32(4), int64(-5), uint(6), uint8(7), uint16(8), uint32(9),
+		uint64(10), float32(1.1), 2.5e21, 0.00001, true, time.Second, nil, errors.New("err"), []byte("ab"),
+		&nilStringer{name: "stringer"}, ns, struct{ A int }{1}}
+	for _, arg := range args {
+		buf := getBuffer()
+		appendArg(buf, arg)
+		assert.Equal(t, fmt.Sprint(arg), string(buf.b))
+		putBuffer(buf)
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	buf := getBuffer()
+	assert.Equal(t, 0, len(buf.b))
+	buf.b = append(buf.b, "data"...)
+	putBuffer(buf)
+	assert.Equal(t, 0, len(getBuffer().b))
+
+	// large buffer is not pooled, and should not panic
+	putBuffer(&buffer{b: make([]byte, maxPooledBufferSize+1)})
+}
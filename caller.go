@@ -1,11 +1,18 @@
 package vlog
 
 import (
+	"bytes"
 	"path"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 )
 
+// the depth of user code calling logger methods, when getCaller is called directly in Transformer.Transform.
+// Transformers calling other transformers should increase LogRecord.callerSkip for the frames they added.
+const transformCallerDepth = 5
+
 type caller struct {
 	packageName  string
 	fileName     string
@@ -13,18 +20,57 @@ type caller struct {
 	line         int
 }
 
+// caller info cached by program counter
+var callerCache = map[uintptr]*caller{}
+var callerCacheLock sync.RWMutex
+
+// getCaller return the caller info, depth is as runtime.Caller skip.
+// The returned caller is cached and shared, should not be modified.
 func getCaller(depth int) *caller {
-	pc, file, line, _ := runtime.Caller(depth)
+	var pcs [1]uintptr
+	if runtime.Callers(depth+1, pcs[:]) == 0 {
+		return &caller{}
+	}
+	return callerOfPC(pcs[0])
+}
+
+// getRecordCaller return the caller of record, depth is as getCaller. If the record has callerPC set, as records
+// not logged by user code directly (such as sampler summaries), the caller at callerPC is returned.
+func getRecordCaller(record *LogRecord, depth int) *caller {
+	if record.callerPC != 0 {
+		return callerOfPC(record.callerPC)
+	}
+	return getCaller(depth + 1)
+}
+
+// the caller info of program counter returned by runtime.Callers
+func callerOfPC(pc uintptr) *caller {
+	callerCacheLock.RLock()
+	c, ok := callerCache[pc]
+	callerCacheLock.RUnlock()
+	if ok {
+		return c
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	c = parseCaller(frame.Function, frame.File, frame.Line)
+	callerCacheLock.Lock()
+	callerCache[pc] = c
+	callerCacheLock.Unlock()
+	return c
+}
+
+// parse caller info from full function name like github.com/user/pkg.(*Type).Method
+func parseCaller(function string, file string, line int) *caller {
 	_, fileName := path.Split(file)
-	parts := strings.Split(runtime.FuncForPC(pc).Name(), ".")
+	parts := strings.Split(function, ".")
 	pl := len(parts)
 	packageName := ""
 	funcName := parts[pl-1]
 
-	if parts[pl-2][0] == '(' {
+	if pl >= 3 && strings.HasPrefix(parts[pl-2], "(") {
 		funcName = parts[pl-2] + "." + funcName
 		packageName = strings.Join(parts[0:pl-2], ".")
-	} else {
+	} else if pl >= 2 {
 		packageName = strings.Join(parts[0:pl-1], ".")
 	}
 
@@ -35,3 +81,15 @@ func getCaller(depth int) *caller {
 		line:         line,
 	}
 }
+
+// goroutineID return the id of current goroutine, parsed from stack trace header like "goroutine 18 [running]:"
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	header := bytes.TrimPrefix(buf[:n], []byte("goroutine "))
+	if idx := bytes.IndexByte(header, ' '); idx > 0 {
+		header = header[:idx]
+	}
+	id, _ := strconv.ParseUint(string(header), 10, 64)
+	return id
+}
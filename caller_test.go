@@ -12,3 +12,18 @@ func TestCaller(t *testing.T) {
 	assert.Equal(t, "TestCaller", caller.functionName)
 	assert.Equal(t, 9, caller.line)
 }
+
+func TestCallerCache(t *testing.T) {
+	var callers []*caller
+	for i := 0; i < 2; i++ {
+		callers = append(callers, getCaller(1))
+	}
+	assert.True(t, callers[0] == callers[1])
+	assert.Equal(t, "TestCallerCache", callers[0].functionName)
+	assert.Equal(t, "caller_test.go", callers[0].fileName)
+
+	c := parseCaller("github.com/user/pkg.(*Type).Method", "/src/pkg/file.go", 10)
+	assert.Equal(t, "github.com/user/pkg", c.packageName)
+	assert.Equal(t, "(*Type).Method", c.functionName)
+	assert.Equal(t, "file.go", c.fileName)
+}
@@ -0,0 +1,74 @@
+// Command vlog-decrypt decrypt log files written by vlog FileAppender with SetEncryption, and write the plain logs
+// to stdout, like cat.
+//
+// Usage:
+//
+//	vlog-decrypt [-key-file file] path/to/app.log...
+//
+// The key is read from key-file, or VLOG_ENCRYPTION_KEY env. The key is used for all key ids in log files.
+// Key files are used as raw bytes, except the trailing line breaks (\r and \n) are removed.
+//
+// Paths should be passed in the order of writing, the current log file last. The current log file may be still being
+// written, so its missing final chunk is reported as a warning; for other files it is an error.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hsiafan/vlog"
+)
+
+func main() {
+	keyFile := flag.String("key-file", "", "file containing the encryption key, VLOG_ENCRYPTION_KEY env is used if not set")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: vlog-decrypt [-key-file file] path/to/app.log...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	key := []byte(os.Getenv("VLOG_ENCRYPTION_KEY"))
+	if *keyFile != "" {
+		data, err := vlog.ReadKeyFile(*keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "read key file error:", err)
+			os.Exit(2)
+		}
+		key = data
+	}
+
+	keys := vlog.NewStaticKeyProvider("", key)
+	keys.SetFallbackKey(key)
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for idx, path := range flag.Args() {
+		err := decrypt(out, path, keys)
+		if err == vlog.ErrEncryptedLogTruncated && idx == flag.NArg()-1 {
+			out.Flush()
+			fmt.Fprintf(os.Stderr, "warning: %s has no final chunk, it is still being written or truncated\n", path)
+			continue
+		}
+		if err != nil {
+			out.Flush()
+			fmt.Fprintf(os.Stderr, "decrypt %s error: %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func decrypt(out io.Writer, path string, keys vlog.KeyProvider) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(out, vlog.NewDecryptReader(file, keys))
+	return err
+}
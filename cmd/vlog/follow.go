@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+)
+
+// followReader read the new lines appended to log file, following the file across rotations.
+// FileAppender rotates by renaming the log file and creating a new one with the same path; when the path refers to
+// a new file, and the old one is read to end, the new file is read from start.
+// Read only return complete lines. If there is no new data, Read wait for one interval for the rest of multi-line
+// records, then return io.EOF for the reader to output its last record; the following Read block polling by interval.
+// When the file is rotated or truncated, the unterminated last line is returned as a line, then Read return io.EOF
+// until nextFile is called, to read the new content by a new reader.
+type followReader struct {
+	path     string
+	interval time.Duration
+	idle     func() error // called before waiting for new data
+	file     *os.File
+	offset   int64  // read offset of file
+	lines    []byte // complete lines not returned yet
+	partial  []byte // the data after last line break
+	chunk    []byte
+	paused   bool // io.EOF is returned as there is no new data, and no data is read after that
+	ended    bool // the file is rotated or truncated, and the new content is not read yet
+}
+
+// create followReader reading lines appended after now, idle may be nil
+func newFollowReader(path string, interval time.Duration, idle func() error) (*followReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &followReader{
+		path:     path,
+		interval: interval,
+		idle:     idle,
+		file:     file,
+		offset:   offset,
+		chunk:    make([]byte, 32*1024),
+	}, nil
+}
+
+func (f *followReader) Read(p []byte) (int, error) {
+	for len(f.lines) == 0 {
+		if f.ended {
+			return 0, io.EOF
+		}
+		n, err := f.file.Read(f.chunk)
+		if n > 0 {
+			f.paused = false
+			f.offset += int64(n)
+			data := append(f.partial, f.chunk[:n]...)
+			if idx := bytes.LastIndexByte(data, '\n'); idx >= 0 {
+				f.lines = data[:idx+1]
+				f.partial = append([]byte(nil), data[idx+1:]...)
+			} else {
+				f.partial = data
+			}
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if f.paused {
+			if err = f.wait(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		// wait one interval for the rest of records being written
+		ready, err := f.sleepAndPoll()
+		if err != nil {
+			return 0, err
+		}
+		if !ready {
+			f.paused = true
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, f.lines)
+	f.lines = f.lines[n:]
+	return n, nil
+}
+
+// nextFile return true if the file is rotated or truncated, then Read return the new content.
+// Should be called after Read return io.EOF.
+func (f *followReader) nextFile() bool {
+	if !f.ended || len(f.lines) > 0 {
+		return false
+	}
+	f.ended = false
+	return true
+}
+
+// wait until there is new data in file, or the file is rotated or truncated, polling by interval
+func (f *followReader) wait() error {
+	for {
+		ready, err := f.sleepAndPoll()
+		if err != nil || ready {
+			return err
+		}
+	}
+}
+
+func (f *followReader) sleepAndPoll() (bool, error) {
+	if f.idle != nil {
+		if err := f.idle(); err != nil {
+			return false, err
+		}
+	}
+	time.Sleep(f.interval)
+	return f.poll()
+}
+
+// check the file for new data, rotation and truncation. Return true if there is data to read, or the file ended.
+func (f *followReader) poll() (bool, error) {
+	info, err := f.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Size() > f.offset {
+		return true, nil
+	}
+	if info.Size() < f.offset {
+		// truncated, read from start
+		if _, err = f.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		f.reset()
+		return true, nil
+	}
+
+	pathInfo, err := os.Stat(f.path)
+	if os.IsNotExist(err) {
+		// renamed, the new file is not created yet
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if os.SameFile(info, pathInfo) {
+		return false, nil
+	}
+	// the old file may be written before renamed, read it to end first
+	if info, err = f.file.Stat(); err != nil {
+		return false, err
+	}
+	if info.Size() > f.offset {
+		return true, nil
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return false, err
+	}
+	f.file.Close()
+	f.file = file
+	f.reset()
+	return true, nil
+}
+
+// the old file ended, read the new content from start. The unterminated last line of old file is kept as a line.
+func (f *followReader) reset() {
+	f.ended = true
+	f.paused = false
+	f.offset = 0
+	if len(f.partial) > 0 {
+		f.lines = append(f.partial, '\n')
+	}
+	f.partial = nil
+}
+
+// Close close the file being read
+func (f *followReader) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,256 @@
+// Command vlog read log files written by vlog, filter records, and output them as pattern text or json lines.
+// It can follow a log file across rotations like tail -f, and merge multiple log files by record time.
+//
+// Usage:
+//
+//	vlog [flags] path/to/app.log...
+//
+// Path "-" reads from stdin. Examples:
+//
+//	vlog -f -level warn app.log                      follow app.log, output Warn and above records
+//	vlog -rotated -logger db -since 1h app.log       records of logger db and db/..., in the last hour
+//	vlog -grep 'timeout|refused' a.log b.log         merge two files by time, with messages matching regex
+//	vlog -out json app.log                           convert pattern text to json lines
+//	vlog -out-pattern '{time} {message}\n' app.json  convert json lines to pattern text
+//
+// Input format is detected for each file by default: files starting with '{' are json lines written by
+// JSONTransformer, others are pattern text written by PatternTransformer with -pattern.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hsiafan/vlog"
+)
+
+const defaultPattern = "{time} [{Level}] {logger} - {message}\n"
+
+// escapes in pattern flags, as line breaks are hard to pass in command line
+var patternEscapes = strings.NewReplacer(`\n`, "\n", `\t`, "\t")
+
+// options of command, parsed from flags
+type options struct {
+	pattern    string
+	in         string
+	out        string
+	outPattern string
+	follow     bool
+	rotated    bool
+	interval   time.Duration
+	filter     filter
+}
+
+func main() {
+	opts, paths, err := parseFlags(flag.CommandLine, os.Args[1:], time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err = run(opts, paths, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func parseFlags(fs *flag.FlagSet, args []string, now time.Time) (*options, []string, error) {
+	opts := &options{}
+	var level, logger, since, until, grep string
+	fs.StringVar(&opts.pattern, "pattern", defaultPattern, "the pattern of log text, same as passed to NewPatternTransformer, \\n and \\t are unescaped")
+	fs.StringVar(&opts.in, "in", "auto", "input format: auto, text or json")
+	fs.StringVar(&opts.out, "out", "text", "output format: text or json")
+	fs.StringVar(&opts.outPattern, "out-pattern", "", "the pattern of output text, the input pattern is used if not set")
+	fs.BoolVar(&opts.follow, "f", false, "follow the log file across rotations, output new records as they are written")
+	fs.BoolVar(&opts.rotated, "rotated", false, "also read the rotated files of log files, including gzipped ones")
+	fs.DurationVar(&opts.interval, "interval", 200*time.Millisecond, "the interval polling the log file when following")
+	fs.StringVar(&level, "level", "", "output records with this level and above, such as warn")
+	fs.StringVar(&logger, "logger", "", "output records of loggers matching prefixes, separated by ','")
+	fs.StringVar(&since, "since", "", "output records at or after the time, as RFC3339, '2006-01-02 15:04:05', or duration ago like 1h")
+	fs.StringVar(&until, "until", "", "output records before the time, in the same formats as -since")
+	fs.StringVar(&grep, "grep", "", "output records with messages matching the regex")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: vlog [flags] path/to/app.log...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	paths := fs.Args()
+	if len(paths) == 0 {
+		fs.Usage()
+		return nil, nil, errors.New("no log files")
+	}
+	if opts.in != "auto" && opts.in != "text" && opts.in != "json" {
+		return nil, nil, errors.New("invalid input format: " + opts.in)
+	}
+	if opts.out != "text" && opts.out != "json" {
+		return nil, nil, errors.New("invalid output format: " + opts.out)
+	}
+	if opts.follow && (len(paths) > 1 || paths[0] == "-") {
+		return nil, nil, errors.New("only one log file can be followed")
+	}
+	opts.pattern = patternEscapes.Replace(opts.pattern)
+	if opts.outPattern == "" {
+		opts.outPattern = opts.pattern
+	}
+	opts.outPattern = patternEscapes.Replace(opts.outPattern)
+
+	var err error
+	if level != "" {
+		if opts.filter.level, err = parseLevel(level); err != nil {
+			return nil, nil, err
+		}
+	}
+	if logger != "" {
+		opts.filter.loggers = strings.Split(logger, ",")
+	}
+	if since != "" {
+		if opts.filter.since, err = parseTime(since, now); err != nil {
+			return nil, nil, err
+		}
+	}
+	if until != "" {
+		if opts.filter.until, err = parseTime(until, now); err != nil {
+			return nil, nil, err
+		}
+	}
+	if grep != "" {
+		if opts.filter.grep, err = regexp.Compile(grep); err != nil {
+			return nil, nil, err
+		}
+	}
+	return opts, paths, nil
+}
+
+// run read the log files, output records passed filter to out. Warnings for unparsable records are written to warn.
+func run(opts *options, paths []string, out io.Writer, warn io.Writer) error {
+	var transformer vlog.AppendTransformer = vlog.NewJSONTransformer(false)
+	if opts.out == "text" {
+		t, err := vlog.NewPatternTransformer(opts.outPattern)
+		if err != nil {
+			return err
+		}
+		transformer = t
+	}
+	parser, err := vlog.NewPatternParser(opts.pattern)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+	output := func(reader recordReader) error {
+		return copyRecords(w, reader, &opts.filter, transformer, warn)
+	}
+
+	if opts.follow {
+		// flush output before waiting for new data
+		f, err := newFollowReader(paths[0], opts.interval, w.Flush)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// one reader for each file, until it is rotated or truncated.
+		// The reader stops when there is no new data, after output its last record.
+		reader := newRecordReader(bufio.NewReader(f), opts.in, parser)
+		for {
+			if err = output(reader); err != nil {
+				return err
+			}
+			if err = w.Flush(); err != nil {
+				return err
+			}
+			if f.nextFile() {
+				reader = newRecordReader(bufio.NewReader(f), opts.in, parser)
+			}
+		}
+	}
+
+	var readers []recordReader
+	for _, path := range paths {
+		file, err := openLogFile(path, opts.rotated)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		readers = append(readers, newRecordReader(bufio.NewReader(file), opts.in, parser))
+	}
+	if len(readers) == 1 {
+		return output(readers[0])
+	}
+	return output(newMergeReader(readers))
+}
+
+// open log file, "-" for stdin
+func openLogFile(path string, rotated bool) (io.ReadCloser, error) {
+	if path == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	if rotated {
+		return vlog.OpenLogFiles(path)
+	}
+	return os.Open(path)
+}
+
+// copy records passed filter from reader to w, until reader is exhausted
+func copyRecords(w io.Writer, reader recordReader, filter *filter, transformer vlog.AppendTransformer,
+	warn io.Writer) error {
+	var buf []byte
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var parseErr *parseError
+			if errors.As(err, &parseErr) {
+				fmt.Fprintln(warn, "skip record:", err)
+				continue
+			}
+			return err
+		}
+		if !filter.match(&record) {
+			continue
+		}
+		buf = transformer.AppendTransform(buf[:0], record)
+		if _, err = w.Write(buf); err != nil {
+			return err
+		}
+	}
+}
+
+// the levels can be used with -level
+var levels = []vlog.Level{vlog.Trace, vlog.Debug, vlog.Info, vlog.Warn, vlog.Error, vlog.Critical}
+
+func parseLevel(str string) (vlog.Level, error) {
+	for _, level := range levels {
+		if strings.EqualFold(level.Name(), str) {
+			return level, nil
+		}
+	}
+	return 0, errors.New("invalid level: " + str)
+}
+
+// parse time as RFC3339, local date time, or duration before now
+func parseTime(str string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(str); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, str, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid time: " + str)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hsiafan/vlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func runCommand(t *testing.T, args ...string) (string, string) {
+	opts, paths, err := parseFlags(flag.NewFlagSet("vlog", flag.ContinueOnError), args, time.Now())
+	assert.NoError(t, err)
+	var out, warn bytes.Buffer
+	assert.NoError(t, run(opts, paths, &out, &warn))
+	return out.String(), warn.String()
+}
+
+func TestRun_Merge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vlog-cmd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.log")
+	b := filepath.Join(dir, "b.log")
+	writeFile(t, a, "2024-01-02 10:00:00.000 [Info] app - start\n"+
+		"2024-01-02 10:00:02.000 [Error] app/db - query failed\n  at line 2\n"+
+		"2024-01-02 10:00:04.000 [Warn] other - slow\n")
+	writeFile(t, b, "2024-01-02 10:00:01.000 [Warn] app/dbx - b1\n"+
+		"2024-01-02 10:00:03.000 [Debug] app - b2\n")
+
+	out, _ := runCommand(t, a, b)
+	assert.Equal(t, "2024-01-02 10:00:00.000 [Info] app - start\n"+
+		"2024-01-02 10:00:01.000 [Warn] app/dbx - b1\n"+
+		"2024-01-02 10:00:02.000 [Error] app/db - query failed\n  at line 2\n"+
+		"2024-01-02 10:00:03.000 [Debug] app - b2\n"+
+		"2024-01-02 10:00:04.000 [Warn] other - slow\n", out)
+
+	out, _ = runCommand(t, "-level", "warn", "-logger", "app/db,other", a, b)
+	assert.Equal(t, "2024-01-02 10:00:02.000 [Error] app/db - query failed\n  at line 2\n"+
+		"2024-01-02 10:00:04.000 [Warn] other - slow\n", out)
+
+	out, _ = runCommand(t, "-since", "2024-01-02 10:00:01", "-until", "2024-01-02 10:00:04", "-grep", "^b", a, b)
+	assert.Equal(t, "2024-01-02 10:00:01.000 [Warn] app/dbx - b1\n"+
+		"2024-01-02 10:00:03.000 [Debug] app - b2\n", out)
+
+	writeFile(t, b, "2024-01-02 10:00:01.000 [Unknown] app - b1\n")
+	out, warn := runCommand(t, "-logger", "other", a, b)
+	assert.Equal(t, "2024-01-02 10:00:04.000 [Warn] other - slow\n", out)
+	assert.Contains(t, warn, "unknown log level")
+}
+
+func TestRun_Convert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vlog-cmd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.json")
+	writeFile(t, path, `{"time":"2024-01-02T10:00:00Z","level":"Info","logger":"app","message":"login",`+
+		`"file":"main.go","user":"bob","count":3,"field.level":"x","error":{"message":"denied"}}`+"\n\n")
+
+	out, _ := runCommand(t, "-out", "json", path)
+	assert.Equal(t, `{"time":"2024-01-02T10:00:00Z","level":"Info","logger":"app","message":"login",`+
+		`"user":"bob","count":3,"field.level":"x","error":"{\"message\":\"denied\"}"}`+"\n", out)
+
+	out, _ = runCommand(t, "-out-pattern", `{time|2006-01-02T15:04:05|UTC} {level} {message} {field:user}\n`, path)
+	assert.Equal(t, "2024-01-02T10:00:00 info login bob\n", out)
+}
+
+func TestFollowReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vlog-cmd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "old line\n")
+
+	f, err := newFollowReader(path, time.Millisecond, nil)
+	assert.NoError(t, err)
+	defer f.Close()
+	read := func(size int) string {
+		data := make([]byte, size)
+		_, err := io.ReadFull(f, data)
+		assert.NoError(t, err)
+		return string(data)
+	}
+	assertEOF := func() {
+		n, err := f.Read(make([]byte, 10))
+		assert.Equal(t, 0, n)
+		assert.Equal(t, io.EOF, err)
+	}
+	// no new data
+	assertEOF()
+	assert.False(t, f.nextFile())
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	file.WriteString("line1\nline")
+	// only complete lines are returned
+	assert.Equal(t, "line1\n", read(6))
+	file.WriteString("2\nline")
+	file.Close()
+	assert.Equal(t, "line2\n", read(6))
+
+	// rotated as FileAppender does, the unterminated last line is returned, then io.EOF for the old file
+	assert.NoError(t, os.Rename(path, filepath.Join(dir, "app.1.log")))
+	writeFile(t, path, "line3\n")
+	assert.Equal(t, "line\n", read(5))
+	assertEOF()
+	assertEOF()
+	assert.True(t, f.nextFile())
+	assert.Equal(t, "line3\n", read(6))
+
+	// truncated
+	writeFile(t, path, "")
+	ready, err := f.poll()
+	assert.NoError(t, err)
+	assert.True(t, ready)
+	writeFile(t, path, "line4\n")
+	assertEOF()
+	assert.True(t, f.nextFile())
+	assert.Equal(t, "line4\n", read(6))
+
+	ready, err = f.poll()
+	assert.NoError(t, err)
+	assert.False(t, ready)
+}
+
+// follow with writes run when reader is waiting for new data
+func followWrites(t *testing.T, writes ...func(path string) error) (*followReader, *int) {
+	dir, err := ioutil.TempDir("", "vlog-cmd")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "")
+
+	var idles int
+	idle := func() error {
+		idles++
+		if len(writes) == 0 {
+			return nil
+		}
+		write := writes[0]
+		writes = writes[1:]
+		return write(path)
+	}
+	f, err := newFollowReader(path, time.Millisecond, idle)
+	assert.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f, &idles
+}
+
+func appendText(text string) func(path string) error {
+	return func(path string) error {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = file.WriteString(text)
+		return err
+	}
+}
+
+func rotate(path string) error {
+	if err := os.Rename(path, path+".1"); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, nil, 0644)
+}
+
+func TestFollowReader_MultiLineRecord(t *testing.T) {
+	f, idles := followWrites(t,
+		appendText("2024-01-02 10:00:00.000 [Error] app - query failed\n"),
+		appendText("  at line 2\n"),
+		appendText("2024-01-02 10:00:01.000 [Info] app - next\n"),
+		// the last record is returned when file is rotated
+		rotate,
+	)
+	parser, err := vlog.NewPatternParser(defaultPattern)
+	assert.NoError(t, err)
+	reader := newRecordReader(bufio.NewReader(f), "auto", parser)
+	record, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "query failed\n  at line 2", record.Message)
+	record, err = reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "next", record.Message)
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 4, *idles)
+	assert.True(t, f.nextFile())
+}
+
+func TestFollowReader_Idle(t *testing.T) {
+	f, idles := followWrites(t,
+		appendText("\n"),
+		appendText("2024-01-02 10:00:00.000 [Error] app - query failed\n"),
+	)
+	parser, err := vlog.NewPatternParser(defaultPattern)
+	assert.NoError(t, err)
+	reader := newRecordReader(bufio.NewReader(f), "auto", parser)
+	// the format is detected after blank lines, and the last record is returned after one interval without new data
+	record, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "query failed", record.Message)
+	assert.False(t, f.nextFile())
+
+	assert.NoError(t, appendText("2024-01-02 10:00:01.000 [Info] app - next\n")(f.path))
+	record, err = reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "next", record.Message)
+	assert.Equal(t, 4, *idles)
+}
+
+func TestMergeReader(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	reader := func(seconds ...int) recordReader {
+		var records []vlog.LogRecord
+		for _, s := range seconds {
+			records = append(records, vlog.LogRecord{LogTime: ts.Add(time.Duration(s) * time.Second), Message: string(rune('a' + s))})
+		}
+		return &sliceReader{records: records}
+	}
+	merged := newMergeReader([]recordReader{reader(0, 2, 2), reader(), reader(1, 2, 5)})
+	var messages string
+	for {
+		record, err := merged.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		messages += record.Message
+	}
+	assert.Equal(t, "abcccf", messages)
+}
+
+type sliceReader struct {
+	records []vlog.LogRecord
+}
+
+func (s *sliceReader) Next() (vlog.LogRecord, error) {
+	if len(s.records) == 0 {
+		return vlog.LogRecord{}, io.EOF
+	}
+	record := s.records[0]
+	s.records = s.records[1:]
+	return record, nil
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	ts, err := parseTime("1h30m", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-90*time.Minute), ts)
+
+	ts, err = parseTime("2024-01-02T08:00:00+08:00", now)
+	assert.NoError(t, err)
+	assert.True(t, ts.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)))
+
+	ts, err = parseTime("2024-01-02 08:00:00.5", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 8, 0, 0, 500000000, time.Local), ts)
+
+	_, err = parseTime("yesterday", now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hsiafan/vlog"
+)
+
+// recordReader read log records one by one, return io.EOF if there is no more records
+type recordReader interface {
+	Next() (vlog.LogRecord, error)
+}
+
+// parseError is returned by recordReader when a record can not be parsed, the following records can still be read
+type parseError struct {
+	err error
+}
+
+func (e *parseError) Error() string {
+	return e.err.Error()
+}
+
+// create recordReader for format auto, text or json. For auto, json is used if the first non-blank char is '{'.
+func newRecordReader(r *bufio.Reader, format string, parser *vlog.PatternParser) recordReader {
+	switch format {
+	case "json":
+		return &jsonReader{reader: r}
+	case "text":
+		source := &sourceReader{reader: r}
+		return &textReader{reader: parser.NewReader(source), source: source}
+	default:
+		return &autoReader{reader: r, parser: parser}
+	}
+}
+
+// autoReader detect the format when the first non-blank char is read
+type autoReader struct {
+	reader   *bufio.Reader
+	parser   *vlog.PatternParser
+	detected recordReader
+}
+
+func (a *autoReader) Next() (vlog.LogRecord, error) {
+	if a.detected == nil {
+		format, err := detectFormat(a.reader)
+		if err != nil {
+			// no data yet, or only blank lines
+			return vlog.LogRecord{}, err
+		}
+		a.detected = newRecordReader(a.reader, format, a.parser)
+	}
+	return a.detected.Next()
+}
+
+// peek one more byte each time, as the reader may return io.EOF before data is written when following file
+func detectFormat(r *bufio.Reader) (string, error) {
+	for size := 1; ; size++ {
+		data, err := r.Peek(size)
+		trimmed := bytes.TrimLeft(data, " \t\r\n")
+		if len(trimmed) > 0 {
+			if trimmed[0] == '{' {
+				return "json", nil
+			}
+			return "text", nil
+		}
+		if err == bufio.ErrBufferFull {
+			return "text", nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// sourceReader keep the read error other than io.EOF, to tell read errors from parse errors
+type sourceReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
+}
+
+// textReader read records of pattern text
+type textReader struct {
+	reader *vlog.LogReader
+	source *sourceReader
+}
+
+func (t *textReader) Next() (vlog.LogRecord, error) {
+	record, err := t.reader.Next()
+	if err != nil && err != io.EOF && t.source.err == nil {
+		return record, &parseError{err: err}
+	}
+	return record, err
+}
+
+// jsonReader read records of json lines written by JSONTransformer
+type jsonReader struct {
+	reader *bufio.Reader
+}
+
+func (j *jsonReader) Next() (vlog.LogRecord, error) {
+	for {
+		line, err := j.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return vlog.LogRecord{}, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err == io.EOF {
+				return vlog.LogRecord{}, io.EOF
+			}
+			continue
+		}
+		record, parseErr := parseJSONRecord(line)
+		if parseErr != nil {
+			return record, &parseError{err: parseErr}
+		}
+		return record, nil
+	}
+}
+
+// keys of caller info in json lines, they are not converted to fields
+var jsonCallerKeys = map[string]bool{"package": true, "file": true, "function": true, "line": true}
+
+// parse one json line to record. Keys other than time, level, logger, message and caller info are fields, in order;
+// field values of json object or array are kept as compact json text.
+func parseJSONRecord(line []byte) (vlog.LogRecord, error) {
+	var record vlog.LogRecord
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return record, errors.New("json log line is not an object: " + strings.TrimSpace(string(line)))
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return record, err
+		}
+		key := token.(string)
+		var raw json.RawMessage
+		if err = decoder.Decode(&raw); err != nil {
+			return record, err
+		}
+		var value interface{}
+		if err = json.Unmarshal(raw, &value); err != nil {
+			return record, err
+		}
+		switch key {
+		case "time":
+			str, _ := value.(string)
+			if record.LogTime, err = time.Parse(time.RFC3339Nano, str); err != nil {
+				return record, errors.New("invalid log time: " + string(raw))
+			}
+		case "level":
+			str, _ := value.(string)
+			if record.Level, err = parseLevel(str); err != nil {
+				return record, err
+			}
+		case "logger":
+			record.LoggerName, _ = value.(string)
+		case "message":
+			record.Message, _ = value.(string)
+		default:
+			if jsonCallerKeys[key] {
+				continue
+			}
+			key = strings.TrimPrefix(key, "field.")
+			record.Fields = append(record.Fields, vlog.F(key, jsonFieldValue(value, raw)))
+		}
+	}
+	return record, nil
+}
+
+func jsonFieldValue(value interface{}, raw json.RawMessage) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}, []interface{}:
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, raw); err != nil {
+			return string(raw)
+		}
+		return buf.String()
+	default:
+		return v
+	}
+}
+
+// mergeReader merge records from multiple readers by log time.
+// Records in each reader should be ordered by time, records with the same time are output in the order of readers.
+type mergeReader struct {
+	readers []recordReader
+	heads   []*vlog.LogRecord // the next record of each reader, nil if not read yet
+	done    []bool
+}
+
+func newMergeReader(readers []recordReader) *mergeReader {
+	return &mergeReader{
+		readers: readers,
+		heads:   make([]*vlog.LogRecord, len(readers)),
+		done:    make([]bool, len(readers)),
+	}
+}
+
+func (m *mergeReader) Next() (vlog.LogRecord, error) {
+	selected := -1
+	for idx, reader := range m.readers {
+		if m.done[idx] {
+			continue
+		}
+		if m.heads[idx] == nil {
+			record, err := reader.Next()
+			if err == io.EOF {
+				m.done[idx] = true
+				continue
+			}
+			if err != nil {
+				// parse errors are skipped by caller, the reader is read again at next call
+				return record, err
+			}
+			m.heads[idx] = &record
+		}
+		if selected < 0 || m.heads[idx].LogTime.Before(m.heads[selected].LogTime) {
+			selected = idx
+		}
+	}
+	if selected < 0 {
+		return vlog.LogRecord{}, io.EOF
+	}
+	record := *m.heads[selected]
+	m.heads[selected] = nil
+	return record, nil
+}
+
+// filter select records to output. Zero values mean no filtering.
+type filter struct {
+	level   vlog.Level
+	loggers []string // logger name prefixes, record matches any one
+	since   time.Time
+	until   time.Time
+	grep    *regexp.Regexp
+}
+
+func (f *filter) match(record *vlog.LogRecord) bool {
+	if record.Level < f.level {
+		return false
+	}
+	if len(f.loggers) > 0 && !f.matchLogger(record.LoggerName) {
+		return false
+	}
+	if !f.since.IsZero() && record.LogTime.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !record.LogTime.Before(f.until) {
+		return false
+	}
+	if f.grep != nil && !f.grep.MatchString(record.Message) {
+		return false
+	}
+	return true
+}
+
+func (f *filter) matchLogger(name string) bool {
+	for _, prefix := range f.loggers {
+		if vlog.MatchLoggerPrefix(name, strings.TrimSpace(prefix)) {
+			return true
+		}
+	}
+	return false
+}
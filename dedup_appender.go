@@ -0,0 +1,207 @@
+package vlog
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+var _ Appender = (*DedupAppender)(nil)
+var _ Transformer = (*DedupAppender)(nil)
+var _ Flusher = (*DedupAppender)(nil)
+
+// DedupAppender wrap a target appender, collapse consecutive duplicate records within a time window, as syslogd do:
+// the first record is written, the following duplicates are counted, and a "last message repeated N times" record is
+// written when a different record arrives, or the window passed after the last duplicate.
+// Records are duplicate if they have same logger, level, message and fields; or have same logger, level and caller,
+// if SetMatchCaller is set. The caller info of "repeated" records are not accurate.
+//
+// DedupAppender is the transformer of itself, it checks records when transforming, and transforms them by the target's
+// transformer. SetTransformer set the transformer of target.
+type DedupAppender struct {
+	target      Appender
+	window      time.Duration
+	matchCaller bool
+	lock        sync.Mutex
+	last        LogRecord // the last record written
+	lastCaller  *caller
+	lastTime    time.Time // the time of last duplicate
+	repeated    int
+	timer       *time.Timer
+	pending     []AppendEvent // "repeated" events transformed, to be written before the next event
+}
+
+// NewDedupAppender create dedup appender, which write records to target.
+// window is the max interval between duplicates to be collapsed.
+func NewDedupAppender(target Appender, window time.Duration) *DedupAppender {
+	return &DedupAppender{target: target, window: window}
+}
+
+// SetMatchCaller treat records from the same caller code position, with same logger and level as duplicates,
+// even if their messages are different, for logs with changing content like counters or ids.
+// This method should be called before appender start to work.
+func (d *DedupAppender) SetMatchCaller(matchCaller bool) {
+	d.matchCaller = matchCaller
+}
+
+// Transformer return the dedup appender itself
+func (d *DedupAppender) Transformer() Transformer {
+	return d
+}
+
+// SetTransformer set transformer to the target appender
+func (d *DedupAppender) SetTransformer(transformer Transformer) {
+	d.target.SetTransformer(transformer)
+}
+
+// Transform check if the record is a duplicate, and transform record by the target's transformer.
+// Nil message is returned for duplicates, which would be skipped when appending.
+// If there are collapsed duplicates before this record, the "repeated" record is transformed and kept, and written
+// by Append as a separate event before this record.
+func (d *DedupAppender) Transform(record LogRecord) AppendEvent {
+	var recordCaller *caller
+	if d.matchCaller {
+		recordCaller = getRecordCaller(&record, transformCallerDepth+record.callerSkip)
+	}
+	record.callerSkip++
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.isDuplicate(record, recordCaller) {
+		d.repeated++
+		d.lastTime = record.LogTime
+		if d.timer == nil {
+			d.timer = time.AfterFunc(d.window, d.expire)
+		}
+		return AppendEvent{LoggerName: record.LoggerName, Level: record.Level}
+	}
+
+	transformer := d.target.Transformer()
+	if d.repeated > 0 {
+		repeatedRecord := d.repeatedRecord()
+		repeatedRecord.callerSkip = record.callerSkip
+		d.pending = append(d.pending, transformer.Transform(repeatedRecord).Clone())
+	}
+	event := transformer.Transform(record)
+	d.reset()
+	d.last = record
+	d.lastCaller = recordCaller
+	d.lastTime = record.LogTime
+	return event
+}
+
+// if the record is a duplicate of last record. Should be called with lock held.
+func (d *DedupAppender) isDuplicate(record LogRecord, recordCaller *caller) bool {
+	last := d.last
+	if last.LogTime.IsZero() || record.LogTime.Sub(d.lastTime) > d.window ||
+		record.LoggerName != last.LoggerName || record.Level != last.Level {
+		return false
+	}
+	if d.matchCaller {
+		return recordCaller == d.lastCaller
+	}
+	if record.Message != last.Message || len(record.Fields) != len(last.Fields) {
+		return false
+	}
+	for idx, field := range record.Fields {
+		if field.Key != last.Fields[idx].Key || fieldText(field.Value) != fieldText(last.Fields[idx].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// the record telling how many times the last record is repeated. Should be called with lock held.
+func (d *DedupAppender) repeatedRecord() LogRecord {
+	return LogRecord{
+		LoggerName: d.last.LoggerName,
+		Level:      d.last.Level,
+		LogTime:    d.lastTime,
+		Message:    "last message repeated " + strconv.Itoa(d.repeated) + " times",
+		Fields:     []Field{F("repeated", d.repeated)},
+	}
+}
+
+// reset duplicate counting. Should be called with lock held.
+func (d *DedupAppender) reset() {
+	d.repeated = 0
+	d.last = LogRecord{}
+	d.lastCaller = nil
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
+
+// called by timer, write the repeated record if the window passed after the last duplicate
+func (d *DedupAppender) expire() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.repeated == 0 {
+		return
+	}
+	if wait := d.window - time.Since(d.lastTime); wait > 0 {
+		d.timer = time.AfterFunc(wait, d.expire)
+		return
+	}
+	if err := d.writeRepeated(); err != nil {
+		reportError("write repeated log failed", err)
+	}
+}
+
+// write the repeated record to target, and reset duplicate counting. Should be called with lock held.
+func (d *DedupAppender) writeRepeated() error {
+	if err := d.writePending(); err != nil {
+		return err
+	}
+	event := d.target.Transformer().Transform(d.repeatedRecord())
+	d.reset()
+	return d.target.Append(event)
+}
+
+// Append write the pending "repeated" events and the event to target, each by one Append call. Duplicates are skipped.
+func (d *DedupAppender) Append(event AppendEvent) error {
+	if err := d.appendPending(); err != nil {
+		return err
+	}
+	if event.Message == nil {
+		return nil
+	}
+	return d.target.Append(event)
+}
+
+func (d *DedupAppender) appendPending() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.writePending()
+}
+
+// write the pending "repeated" events to target. Should be called with lock held.
+func (d *DedupAppender) writePending() error {
+	for len(d.pending) > 0 {
+		event := d.pending[0]
+		d.pending = d.pending[1:]
+		if err := d.target.Append(event); err != nil {
+			return err
+		}
+	}
+	d.pending = nil
+	return nil
+}
+
+func (d *DedupAppender) wrappedAppender() Appender {
+	return d.target
+}
+
+// Flush write the "repeated" record now if there are collapsed duplicates
+func (d *DedupAppender) Flush() error {
+	if err := d.appendPending(); err != nil {
+		return err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.repeated == 0 {
+		return nil
+	}
+	return d.writeRepeated()
+}
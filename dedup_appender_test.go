@@ -0,0 +1,97 @@
+package vlog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupAppender(t *testing.T) {
+	target := NewBytesAppender()
+	appender := NewDedupAppender(target, time.Hour)
+	appender.SetTransformer(MustNewPatternTransformer("{Level} {message} {fields}\n"))
+	logger := GetLogger("dedup_appender_test")
+	logger.SetAppenders(appender)
+
+	for i := 0; i < 3; i++ {
+		logger.Warn("connection refused")
+	}
+	logger.Warn("connection refused", F("host", "a"))
+	logger.Warn("connection refused", F("host", "a"))
+	logger.Error("connection refused", F("host", "a"))
+	logger.Error("connection refused", F("host", "a"))
+	assert.NoError(t, appender.Flush())
+	assert.NoError(t, appender.Flush())
+	logger.Error("connection refused", F("host", "a"))
+
+	assert.Equal(t, []string{
+		"Warn connection refused ",
+		"Warn last message repeated 2 times repeated=2",
+		"Warn connection refused host=a",
+		"Warn last message repeated 1 times repeated=1",
+		"Error connection refused host=a",
+		"Error last message repeated 1 times repeated=1",
+		"Error connection refused host=a",
+	}, strings.Split(strings.TrimSpace(target.buffer.String()), "\n"))
+}
+
+func TestDedupAppender_Window(t *testing.T) {
+	target := NewBytesAppender()
+	appender := NewDedupAppender(target, 30*time.Millisecond)
+	appender.SetTransformer(MustNewPatternTransformer("{message}\n"))
+	logger := GetLogger("dedup_appender_test/window")
+	logger.SetAppenders(appender)
+
+	logger.Info("retry")
+	logger.Info("retry")
+	time.Sleep(100 * time.Millisecond)
+	logger.Info("retry")
+
+	appender.lock.Lock()
+	defer appender.lock.Unlock()
+	assert.Equal(t, "retry\nlast message repeated 1 times\nretry\n", target.buffer.String())
+}
+
+func TestDedupAppender_MatchCaller(t *testing.T) {
+	target := NewBytesAppender()
+	appender := NewDedupAppender(target, time.Hour)
+	appender.SetMatchCaller(true)
+	appender.SetTransformer(MustNewPatternTransformer("{file} {function} {message}\n"))
+	logger := GetLogger("dedup_appender_test/caller")
+	logger.SetAppenders(appender)
+
+	for i := 0; i < 3; i++ {
+		logger.Info("retry", i)
+	}
+	logger.Info("done")
+	assert.Equal(t, "dedup_appender_test.go TestDedupAppender_MatchCaller retry 0\n"+
+		"dedup_appender_test.go TestDedupAppender_MatchCaller last message repeated 2 times\n"+
+		"dedup_appender_test.go TestDedupAppender_MatchCaller done\n", target.buffer.String())
+}
+
+// countingAppender record every event appended
+type countingAppender struct {
+	*BytesAppender
+	events []string
+}
+
+func (c *countingAppender) Append(event AppendEvent) error {
+	c.events = append(c.events, string(event.Message))
+	return nil
+}
+
+func TestDedupAppender_SeparateEvents(t *testing.T) {
+	target := &countingAppender{BytesAppender: NewBytesAppender()}
+	appender := NewDedupAppender(target, time.Hour)
+	appender.SetTransformer(MustNewPatternTransformer("{message}\n"))
+	logger := GetLogger("dedup_appender_test/events")
+	logger.SetAppenders(appender)
+
+	logger.Info("retry")
+	logger.Info("retry")
+	logger.Info("retry")
+	logger.Info("done")
+	assert.Equal(t, []string{"retry\n", "last message repeated 2 times\n", "done\n"}, target.events)
+}
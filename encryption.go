@@ -0,0 +1,286 @@
+package vlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// Encrypted log files consist of frames:
+//
+//	'H' "VLOGENC1" <cipher:1> <key id length:1> <key id> <salt:32> <nonce prefix:4>   header frame
+//	'C' <length:4, big endian> <ciphertext>                                           chunk frame
+//	'F' <length:4, big endian> <ciphertext>                                           final chunk frame
+//
+// A header frame starts every segment, written when the appender starts and after rotating. The data key of segment
+// is HMAC-SHA256(key, salt), with a fresh random salt. Chunks are sealed by AES-256-GCM, the nonce is
+// nonce prefix + chunk counter (8 bytes big endian) in segment. A final chunk with empty data ends the segment,
+// written when the appender is closed and before rotating; it is sealed with additional data "final", so it can not
+// be forged from other chunks, and truncating the file at chunk boundaries is detected by the missing final chunk.
+
+const (
+	encryptMagic       = "VLOGENC1"
+	frameHeader        = 'H'
+	frameChunk         = 'C'
+	frameFinal         = 'F'
+	cipherAESGCM       = 1
+	encryptSaltSize    = 32
+	noncePrefixSize    = 4
+	maxEncryptedChunk  = 64 * 1024 * 1024
+	maxEncryptionKeyID = 255
+)
+
+// the additional authenticated data of final chunks
+var finalChunkData = []byte("final")
+
+// ErrEncryptedLogTruncated is returned by the reader created by NewDecryptReader, after all data is read, if there are
+// segments without final chunk: the log file is truncated, still being written, or the appender is not closed properly.
+var ErrEncryptedLogTruncated = errors.New("encrypted log: segment without final chunk, the log file is truncated " +
+	"or still being written")
+
+// KeyProvider provide keys for encrypting and decrypting log files
+type KeyProvider interface {
+	// CurrentKey return the key and its id, for encrypting new log files. The id is stored in file header.
+	CurrentKey() (id string, key []byte, err error)
+	// Key return the key with id, for decrypting
+	Key(id string) ([]byte, error)
+}
+
+var _ KeyProvider = (*StaticKeyProvider)(nil)
+
+// StaticKeyProvider is a KeyProvider with fixed keys
+type StaticKeyProvider struct {
+	currentID string
+	keys      map[string][]byte
+	fallback  []byte
+}
+
+// NewStaticKeyProvider create key provider, using key with id to encrypt
+func NewStaticKeyProvider(id string, key []byte) *StaticKeyProvider {
+	return &StaticKeyProvider{currentID: id, keys: map[string][]byte{id: key}}
+}
+
+// AddKey add a key only for decrypting, such as retired keys
+func (p *StaticKeyProvider) AddKey(id string, key []byte) {
+	p.keys[id] = key
+}
+
+// SetFallbackKey set the key for decrypting files with key ids not added, such as when one key is used for all ids
+func (p *StaticKeyProvider) SetFallbackKey(key []byte) {
+	p.fallback = key
+}
+
+// CurrentKey return the key for encrypting
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.currentID, p.keys[p.currentID], nil
+}
+
+// Key return the key with id
+func (p *StaticKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		if p.fallback != nil {
+			return p.fallback, nil
+		}
+		return nil, errors.New("unknown encryption key id: " + id)
+	}
+	return key, nil
+}
+
+// ReadKeyFile read key from file, as raw bytes except the trailing line breaks (\r and \n) are removed,
+// as editors and echo usually add one
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(data, "\r\n"), nil
+}
+
+// create AEAD with data key derived from key and salt
+func newSegmentAEAD(key []byte, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypter seal data into chunk frames of one segment
+type encrypter struct {
+	keys    KeyProvider
+	aead    cipher.AEAD
+	nonce   [12]byte
+	counter uint64
+}
+
+// start new segment with fresh data key, return the header frame
+func (e *encrypter) newSegment() ([]byte, error) {
+	id, key, err := e.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > maxEncryptionKeyID {
+		return nil, errors.New("encryption key id too long")
+	}
+	var salt [encryptSaltSize]byte
+	if _, err = io.ReadFull(rand.Reader, salt[:]); err != nil {
+		return nil, err
+	}
+	if _, err = io.ReadFull(rand.Reader, e.nonce[:noncePrefixSize]); err != nil {
+		return nil, err
+	}
+	if e.aead, err = newSegmentAEAD(key, salt[:]); err != nil {
+		return nil, err
+	}
+	e.counter = 0
+
+	header := []byte{frameHeader}
+	header = append(header, encryptMagic...)
+	header = append(header, cipherAESGCM, byte(len(id)))
+	header = append(header, id...)
+	header = append(header, salt[:]...)
+	header = append(header, e.nonce[:noncePrefixSize]...)
+	return header, nil
+}
+
+// append the chunk frame of data to buf
+func (e *encrypter) appendChunk(buf []byte, data []byte) []byte {
+	return e.appendFrame(buf, frameChunk, data, nil)
+}
+
+// append the final chunk frame to buf, which ends the segment
+func (e *encrypter) appendFinal(buf []byte) []byte {
+	return e.appendFrame(buf, frameFinal, nil, finalChunkData)
+}
+
+func (e *encrypter) appendFrame(buf []byte, frameType byte, data []byte, additionalData []byte) []byte {
+	binary.BigEndian.PutUint64(e.nonce[noncePrefixSize:], e.counter)
+	e.counter++
+	buf = append(buf, frameType, 0, 0, 0, 0)
+	start := len(buf)
+	buf = e.aead.Seal(buf, e.nonce[:], data, additionalData)
+	binary.BigEndian.PutUint32(buf[start-4:start], uint32(len(buf)-start))
+	return buf
+}
+
+// decryptReader read plain data from encrypted log files
+type decryptReader struct {
+	reader     *bufio.Reader
+	keys       KeyProvider
+	aead       cipher.AEAD // nil if not in segment
+	nonce      [12]byte
+	counter    uint64
+	plain      []byte // decrypted data not read
+	chunk      []byte
+	unfinished bool // if there are segments without final chunk
+}
+
+// NewDecryptReader create reader decrypting log files written by FileAppender with SetEncryption.
+// keys should provide all keys used by the log file. After all data is read, ErrEncryptedLogTruncated is returned
+// instead of io.EOF if there are segments without final chunk.
+func NewDecryptReader(r io.Reader, keys KeyProvider) io.Reader {
+	return &decryptReader{reader: bufio.NewReader(r), keys: keys}
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if err := d.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// read and decrypt next frame. Return io.EOF if no more frames.
+func (d *decryptReader) readFrame() error {
+	frameType, err := d.reader.ReadByte()
+	if err == io.EOF && (d.unfinished || d.aead != nil) {
+		return ErrEncryptedLogTruncated
+	}
+	if err != nil {
+		return err
+	}
+	switch frameType {
+	case frameHeader:
+		if d.aead != nil {
+			d.unfinished = true
+		}
+		return d.readHeader()
+	case frameChunk, frameFinal:
+		if d.aead == nil {
+			return errors.New("encrypted log: chunk not in segment")
+		}
+		var lenBytes [4]byte
+		if _, err = io.ReadFull(d.reader, lenBytes[:]); err != nil {
+			return errors.New("encrypted log: truncated chunk")
+		}
+		length := binary.BigEndian.Uint32(lenBytes[:])
+		if length > maxEncryptedChunk {
+			return errors.New("encrypted log: invalid chunk length")
+		}
+		if cap(d.chunk) < int(length) {
+			d.chunk = make([]byte, length)
+		}
+		d.chunk = d.chunk[:length]
+		if _, err = io.ReadFull(d.reader, d.chunk); err != nil {
+			return errors.New("encrypted log: truncated chunk")
+		}
+		binary.BigEndian.PutUint64(d.nonce[noncePrefixSize:], d.counter)
+		d.counter++
+		var additionalData []byte
+		if frameType == frameFinal {
+			additionalData = finalChunkData
+		}
+		d.plain, err = d.aead.Open(d.chunk[:0], d.nonce[:], d.chunk, additionalData)
+		if err != nil {
+			return errors.New("encrypted log: chunk authentication failed")
+		}
+		if frameType == frameFinal {
+			d.aead = nil
+		}
+		return nil
+	default:
+		return errors.New("encrypted log: invalid frame type")
+	}
+}
+
+func (d *decryptReader) readHeader() error {
+	var fixed [len(encryptMagic) + 2]byte
+	if _, err := io.ReadFull(d.reader, fixed[:]); err != nil {
+		return errors.New("encrypted log: truncated header")
+	}
+	if string(fixed[:len(encryptMagic)]) != encryptMagic {
+		return errors.New("encrypted log: invalid header magic")
+	}
+	if fixed[len(encryptMagic)] != cipherAESGCM {
+		return errors.New("encrypted log: unsupported cipher")
+	}
+	rest := make([]byte, int(fixed[len(encryptMagic)+1])+encryptSaltSize+noncePrefixSize)
+	if _, err := io.ReadFull(d.reader, rest); err != nil {
+		return errors.New("encrypted log: truncated header")
+	}
+	idLen := len(rest) - encryptSaltSize - noncePrefixSize
+	key, err := d.keys.Key(string(rest[:idLen]))
+	if err != nil {
+		return err
+	}
+	if d.aead, err = newSegmentAEAD(key, rest[idLen:idLen+encryptSaltSize]); err != nil {
+		return err
+	}
+	copy(d.nonce[:noncePrefixSize], rest[idLen+encryptSaltSize:])
+	d.counter = 0
+	return nil
+}
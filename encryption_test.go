@@ -0,0 +1,204 @@
+package vlog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decryptFile(t *testing.T, path string, keys KeyProvider) (string, error) {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	data, err := ioutil.ReadAll(NewDecryptReader(file, keys))
+	return string(data), err
+}
+
+func TestFileAppender_Encryption(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secret.log")
+	keys := NewStaticKeyProvider("k1", []byte("master key"))
+
+	appender, err := NewFileAppender(path, NewSizeRotater(100, 3))
+	assert.NoError(t, err)
+	assert.NoError(t, appender.SetEncryption(keys))
+	appender.SetBuffer(64, time.Hour, Off)
+	var expected strings.Builder
+	for i := 0; i < 20; i++ {
+		message := "tenant data " + strconv.Itoa(i) + "\n"
+		expected.WriteString(message)
+		assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte(message)}))
+	}
+	assert.NoError(t, appender.Close())
+
+	// restart with new key, appending new segment to the file
+	keys2 := NewStaticKeyProvider("k2", []byte("new master key"))
+	keys2.AddKey("k1", []byte("master key"))
+	appender, err = NewFileAppender(path, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, appender.SetEncryption(keys2))
+	assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("after restart\n")}))
+	assert.NoError(t, appender.Close())
+	expected.WriteString("after restart\n")
+
+	files := []string{filepath.Join(dir, "secret.001.log"), filepath.Join(dir, "secret.002.log"), path}
+	var decrypted strings.Builder
+	for _, file := range files {
+		raw := readFile(t, file)
+		assert.True(t, strings.HasPrefix(raw, "HVLOGENC1"), file)
+		assert.NotContains(t, raw, "tenant data")
+		content, err := decryptFile(t, file, keys2)
+		assert.NoError(t, err)
+		decrypted.WriteString(content)
+	}
+	assert.Equal(t, expected.String(), decrypted.String())
+
+	_, err = decryptFile(t, path, NewStaticKeyProvider("k1", []byte("wrong key")))
+	assert.Error(t, err)
+	_, err = decryptFile(t, path, keys)
+	assert.Error(t, err)
+
+	// one key for all ids
+	fallback := NewStaticKeyProvider("", []byte("master key"))
+	fallback.SetFallbackKey([]byte("master key"))
+	content, err := decryptFile(t, files[0], fallback)
+	assert.NoError(t, err)
+	expectedContent, _ := decryptFile(t, files[0], keys2)
+	assert.Equal(t, expectedContent, content)
+}
+
+func TestReadKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vlog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "key")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("key\n\r\n"), 0600))
+	key, err := ReadKeyFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("key"), key)
+}
+
+func TestDecryptReader_Tampered(t *testing.T) {
+	e := &encrypter{keys: NewStaticKeyProvider("k", []byte("key"))}
+	data, err := e.newSegment()
+	assert.NoError(t, err)
+	data = e.appendChunk(data, []byte("line 1\n"))
+	data = e.appendChunk(data, []byte("line 2\n"))
+	truncated := append([]byte(nil), data...)
+	data = e.appendFinal(data)
+
+	plain, err := ioutil.ReadAll(NewDecryptReader(bytes.NewReader(data), e.keys))
+	assert.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\n", string(plain))
+
+	// truncated at chunk boundary
+	plain, err = ioutil.ReadAll(NewDecryptReader(bytes.NewReader(truncated), e.keys))
+	assert.Equal(t, ErrEncryptedLogTruncated, err)
+	assert.Equal(t, "line 1\nline 2\n", string(plain))
+
+	// the last chunk can not be turned to final chunk
+	forged := append([]byte(nil), truncated...)
+	forged[bytes.LastIndexByte(forged[:len(forged)-len("line 2\n")-16-4], frameChunk)] = frameFinal
+	_, err = ioutil.ReadAll(NewDecryptReader(bytes.NewReader(forged), e.keys))
+	assert.EqualError(t, err, "encrypted log: chunk authentication failed")
+
+	// segment without final chunk followed by another segment
+	header, err := e.newSegment()
+	assert.NoError(t, err)
+	next := e.appendFinal(e.appendChunk(header, []byte("line 3\n")))
+	plain, err = ioutil.ReadAll(NewDecryptReader(bytes.NewReader(append(truncated, next...)), e.keys))
+	assert.Equal(t, ErrEncryptedLogTruncated, err)
+	assert.Equal(t, "line 1\nline 2\nline 3\n", string(plain))
+
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = ioutil.ReadAll(NewDecryptReader(bytes.NewReader(tampered), e.keys))
+	assert.Error(t, err)
+
+	_, err = ioutil.ReadAll(NewDecryptReader(strings.NewReader("plain log\n"), e.keys))
+	assert.Error(t, err)
+}
+
+func TestFileAppender_EncryptionWithHashChain(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	keys := NewStaticKeyProvider("k", []byte("key"))
+
+	for i := 0; i < 2; i++ {
+		appender, err := NewFileAppender(path, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, appender.SetEncryption(keys))
+		assert.NoError(t, appender.SetHashChain(nil))
+		assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("record\n")}))
+		assert.NoError(t, appender.Close())
+	}
+	content, err := decryptFile(t, path, keys)
+	assert.NoError(t, err)
+	assert.Contains(t, content, "\n#2 7 ")
+	records, err := VerifyEncryptedHashChain(path, nil, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), records)
+
+	// rotated files
+	appender, err := NewFileAppender(path, NewSizeRotater(60, 3))
+	assert.NoError(t, err)
+	assert.NoError(t, appender.SetEncryption(keys))
+	assert.NoError(t, appender.SetHashChain(nil))
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("rotated record\n")}))
+	}
+	records, err = VerifyEncryptedHashChain(path, nil, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), records)
+	assert.NoError(t, appender.Close())
+
+	// rotated file truncated at chunk boundary, removing its final chunk
+	rotated := filepath.Join(dir, "audit.001.log")
+	data, err := ioutil.ReadFile(rotated)
+	assert.NoError(t, err)
+	finalSize := 1 + 4 + 16
+	assert.Equal(t, byte(frameFinal), data[len(data)-finalSize])
+	assert.NoError(t, ioutil.WriteFile(rotated, data[:len(data)-finalSize], 0644))
+	_, err = VerifyEncryptedHashChain(path, nil, keys)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "without final chunk")
+}
+
+func TestFileAppender_EncryptionPlainFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("plain log\n"), 0644))
+
+	appender, err := NewFileAppender(path, nil)
+	assert.NoError(t, err)
+	defer appender.Close()
+	assert.Error(t, appender.SetEncryption(NewStaticKeyProvider("k", []byte("key"))))
+	assert.Equal(t, "plain log\n", readFile(t, path))
+}
+
+func TestFileAppender_EncryptionRedirectStderr(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+
+	appender, err := NewFileAppender(filepath.Join(dir, "secret.log"), nil)
+	assert.NoError(t, err)
+	defer appender.Close()
+	assert.NoError(t, appender.SetEncryption(NewStaticKeyProvider("k", []byte("key"))))
+	assert.Equal(t, errStderrWithFramedFile, appender.RedirectStderr())
+
+	appender, err = NewFileAppender(filepath.Join(dir, "audit.log"), nil)
+	assert.NoError(t, err)
+	defer appender.Close()
+	assert.NoError(t, appender.SetHashChain(nil))
+	assert.Equal(t, errStderrWithFramedFile, appender.RedirectStderr())
+}
@@ -0,0 +1,141 @@
+package vlog
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"strconv"
+)
+
+// max stack depth captured by ErrWithStack
+const maxStackDepth = 64
+
+// errorValue is the field value created by Err and ErrWithStack
+type errorValue struct {
+	err   error
+	stack []uintptr // nil if stack not captured
+}
+
+func (ev *errorValue) Error() string {
+	return ev.err.Error()
+}
+
+func (ev *errorValue) Unwrap() error {
+	return ev.err
+}
+
+// Err create a field with key "error" for err. Besides the error message, the error type and the causes chain
+// unwrapped by errors.Unwrap are recorded, which can be rendered by {error} pattern variable,
+// and are output as structured json object by JSONTransformer.
+func Err(err error) Field {
+	if err == nil {
+		return F("error", nil)
+	}
+	return F("error", &errorValue{err: err})
+}
+
+// ErrWithStack create error field as Err do, and also capture the stack trace of current goroutine,
+// which can be rendered by {stack} pattern variable.
+func ErrWithStack(err error) Field {
+	if err == nil {
+		return F("error", nil)
+	}
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(2, pcs[:])
+	return F("error", &errorValue{err: err, stack: append([]uintptr(nil), pcs[:n]...)})
+}
+
+// return the first error field value created by Err or ErrWithStack, nil if not found
+func findErrorValue(fields []Field) *errorValue {
+	for _, field := range fields {
+		if ev, ok := field.Value.(*errorValue); ok {
+			return ev
+		}
+	}
+	return nil
+}
+
+// the unwrap chain of error, not including err itself
+func errorCauses(err error) []error {
+	var causes []error
+	for cause := errors.Unwrap(err); cause != nil; cause = errors.Unwrap(cause) {
+		causes = append(causes, cause)
+	}
+	return causes
+}
+
+func errorType(err error) string {
+	if redacted, ok := err.(*redactedError); ok {
+		err = redacted.err
+	}
+	return reflect.TypeOf(err).String()
+}
+
+// append error text with type and causes, like:
+//
+//	read config: open a.yaml: no such file or directory (*fmt.wrapError)
+//	caused by: open a.yaml: no such file or directory (*fs.PathError)
+func appendErrorText(buf []byte, ev *errorValue) []byte {
+	buf = appendErrorLine(buf, ev.err)
+	for _, cause := range errorCauses(ev.err) {
+		buf = append(buf, "\ncaused by: "...)
+		buf = appendErrorLine(buf, cause)
+	}
+	return buf
+}
+
+func appendErrorLine(buf []byte, err error) []byte {
+	buf = append(buf, err.Error()...)
+	buf = append(buf, " ("...)
+	buf = append(buf, errorType(err)...)
+	return append(buf, ')')
+}
+
+// append stack trace as panic output do, two lines for each frame: function name, and file:line with a tab indent
+func appendStack(buf []byte, stack []uintptr) []byte {
+	if len(stack) == 0 {
+		return buf
+	}
+	frames := runtime.CallersFrames(stack)
+	for idx := 0; ; idx++ {
+		frame, more := frames.Next()
+		if idx > 0 {
+			buf = append(buf, '\n')
+		}
+		buf = append(buf, frame.Function...)
+		buf = append(buf, "\n\t"...)
+		buf = append(buf, frame.File...)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(frame.Line), 10)
+		if !more {
+			return buf
+		}
+	}
+}
+
+// append error as json object, with keys message, type, causes and stack
+func appendJSONError(buf []byte, ev *errorValue) []byte {
+	buf = append(buf, `{"message":`...)
+	buf = appendJSONString(buf, ev.err.Error())
+	buf = append(buf, `,"type":`...)
+	buf = appendJSONString(buf, errorType(ev.err))
+	if causes := errorCauses(ev.err); len(causes) > 0 {
+		buf = append(buf, `,"causes":[`...)
+		for idx, cause := range causes {
+			if idx > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, `{"message":`...)
+			buf = appendJSONString(buf, cause.Error())
+			buf = append(buf, `,"type":`...)
+			buf = appendJSONString(buf, errorType(cause))
+			buf = append(buf, '}')
+		}
+		buf = append(buf, ']')
+	}
+	if len(ev.stack) > 0 {
+		buf = append(buf, `,"stack":`...)
+		buf = appendJSONString(buf, string(appendStack(nil, ev.stack)))
+	}
+	return append(buf, '}')
+}
@@ -0,0 +1,54 @@
+package vlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErr(t *testing.T) {
+	cause := &os.PathError{Op: "open", Path: "a.yaml", Err: os.ErrNotExist}
+	err := fmt.Errorf("read config: %w", cause)
+	field := Err(err)
+	assert.Equal(t, "error", field.Key)
+	assert.True(t, errors.Is(field.Value.(error), os.ErrNotExist))
+	assert.Equal(t, err.Error(), fieldText(field.Value))
+	assert.Equal(t, F("error", nil), Err(nil))
+
+	transformer := MustNewPatternTransformer("{message}: {error}|{stack}")
+	event := transformer.Transform(LogRecord{Message: "load failed", Fields: []Field{field}})
+	assert.Equal(t, "load failed: read config: open a.yaml: file does not exist (*fmt.wrapError)\n"+
+		"caused by: open a.yaml: file does not exist (*fs.PathError)\n"+
+		"caused by: file does not exist (*errors.errorString)|", string(event.Message))
+
+	event = transformer.Transform(LogRecord{Message: "no error"})
+	assert.Equal(t, "no error: |", string(event.Message))
+}
+
+func TestErrWithStack(t *testing.T) {
+	field := ErrWithStack(errors.New("failed"))
+	transformer := MustNewPatternTransformer("{stack}")
+	stack := string(transformer.Transform(LogRecord{Fields: []Field{field}}).Message)
+	lines := strings.Split(stack, "\n")
+	assert.Equal(t, "github.com/hsiafan/vlog.TestErrWithStack", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "\t"))
+	assert.True(t, strings.HasSuffix(lines[1], "error_field_test.go:34"))
+}
+
+func TestJSONTransformer_Error(t *testing.T) {
+	err := wrapError("connect failed", errors.New("refused"))
+	event := NewJSONTransformer(false).Transform(LogRecord{Message: "m", Fields: []Field{ErrWithStack(err)}})
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(event.Message, &m))
+	errorObject := m["error"].(map[string]interface{})
+	assert.Equal(t, "connect failed: refused", errorObject["message"])
+	assert.Equal(t, "*vlog.wrappedError", errorObject["type"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"message": "refused", "type": "*errors.errorString"}},
+		errorObject["causes"])
+	assert.True(t, strings.HasPrefix(errorObject["stack"].(string), "github.com/hsiafan/vlog.TestJSONTransformer_Error\n"))
+}
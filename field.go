@@ -0,0 +1,111 @@
+package vlog
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Field is a key-value pair attached to a log record.
+// Pass fields as log args, they are not joined into the log message but kept in LogRecord.Fields:
+//
+//	logger.Info("request finished", vlog.F("status", 200), vlog.F("path", path))
+//
+// context.Context args are also not joined into the log message, but kept in LogRecord.Context.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F create a new Field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// split Field and context.Context args out from other args. The origin args slice is not modified.
+// If there are multi contexts, the last one is used.
+func splitArgs(args []interface{}) ([]interface{}, []Field, context.Context) {
+	var fieldNum = 0
+	var ctxNum = 0
+	for _, arg := range args {
+		switch arg.(type) {
+		case Field:
+			fieldNum++
+		case context.Context:
+			ctxNum++
+		}
+	}
+	if fieldNum == 0 && ctxNum == 0 {
+		return args, nil, nil
+	}
+
+	var fields []Field
+	if fieldNum > 0 {
+		fields = make([]Field, 0, fieldNum)
+	}
+	var ctx context.Context
+	var remains = make([]interface{}, 0, len(args)-fieldNum-ctxNum)
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case Field:
+			fields = append(fields, v)
+		case context.Context:
+			ctx = v
+		default:
+			remains = append(remains, arg)
+		}
+	}
+	return remains, fields, ctx
+}
+
+// fieldValue convert field value to a value can be safely encoded as json
+func fieldValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return v
+	case float32:
+		return fieldValue(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			// json can not encode NaN and Inf
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return v.String()
+	case Redactable:
+		return v.Redacted()
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// fieldText convert field value to text
+func fieldText(value interface{}) string {
+	switch v := fieldValue(value).(type) {
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// quote text if it is empty, or contains white space, quote or '='
+func quoteFieldText(str string) string {
+	if str == "" || strings.IndexFunc(str, func(r rune) bool {
+		return r == '"' || r == '=' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}) >= 0 {
+		return strconv.Quote(str)
+	}
+	return str
+}
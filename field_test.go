@@ -0,0 +1,30 @@
+package vlog
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitArgs(t *testing.T) {
+	ctx := context.Background()
+	args, fields, c := splitArgs([]interface{}{"a", F("k1", 1), 2, ctx, F("k2", "v")})
+	assert.Equal(t, []interface{}{"a", 2}, args)
+	assert.Equal(t, []Field{{"k1", 1}, {"k2", "v"}}, fields)
+	assert.Equal(t, ctx, c)
+
+	args, fields, c = splitArgs([]interface{}{"a", 2})
+	assert.Equal(t, []interface{}{"a", 2}, args)
+	assert.Nil(t, fields)
+	assert.Nil(t, c)
+}
+
+func TestFieldValue(t *testing.T) {
+	assert.Equal(t, 1, fieldValue(1))
+	assert.Equal(t, "error", fieldValue(errors.New("error")))
+	assert.Equal(t, "NaN", fieldValue(math.NaN()))
+	assert.Equal(t, "[1 2]", fieldValue([]int{1, 2}))
+}
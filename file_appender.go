@@ -3,16 +3,31 @@ package vlog
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 )
 
+// FsyncPolicy decide when FileAppender call fsync on log file
+type FsyncPolicy int
+
+// fsync policies
+const (
+	FsyncNever       FsyncPolicy = 0 // never call fsync, leave it to operating system
+	FsyncInterval    FsyncPolicy = 1 // call fsync periodically
+	FsyncEveryRecord FsyncPolicy = 2 // call fsync after every record written
+)
+
+var errFileAppenderClosed = errors.New("file appender is closed")
+var errStderrWithFramedFile = errors.New("stderr redirection can not be used with log file encryption or hash chain")
+
 // FileAppender appender that write log to local file
 type FileAppender struct {
 	*CanFormattedMixin
@@ -20,9 +35,28 @@ type FileAppender struct {
 	file    unsafe.Pointer //*os.File, current opened file
 	rotater Rotater
 	normal  bool
+	stderr  int32 // 1 if stderr is redirected to log file
+
+	// for buffered writing and fsync. lock is only used if buffered writing or fsync is enabled
+	lock        sync.Mutex
+	buffer      []byte
+	bufferSize  int
+	flushLevel  Level
+	fsyncPolicy FsyncPolicy
+	unsynced    bool
+	closed      bool
+	flushStop   chan struct{}
+	syncStop    chan struct{}
+
+	chain    *hashChain // not nil if hash chain is enabled
+	chainBuf []byte
+
+	encrypter  *encrypter // not nil if encryption is enabled
+	encryptBuf []byte
 }
 
 var _ Appender = (*FileAppender)(nil)
+var _ Flusher = (*FileAppender)(nil)
 
 // NewFileAppender create new file appender.
 // path is the base path and filename of log file.
@@ -52,11 +86,351 @@ func NewFileAppender(path string, rotater Rotater) (*FileAppender, error) {
 	}, nil
 }
 
+// SetBuffer enable buffered writing. Logs are written to file when the buffer is full, every flushInterval,
+// or immediately when logging records at or above flushLevel.
+// size <= 0 disables buffered writing; flushInterval <= 0 disables periodic flushing;
+// flushLevel Off disables level-triggered flushing.
+// Buffered logs would be lost if process exits without calling Flush or Close.
+// This method should be called before appender start to work.
+func (f *FileAppender) SetBuffer(size int, flushInterval time.Duration, flushLevel Level) {
+	if size <= 0 {
+		size = 0
+	}
+	f.bufferSize = size
+	f.buffer = make([]byte, 0, size)
+	f.flushLevel = flushLevel
+	f.flushStop = restartTicker(f.flushStop, flushInterval, func() {
+		if err := f.Flush(); err != nil {
+			reportError("flush log file failed", err)
+		}
+	})
+}
+
+// SetFsync set fsync policy, for durability-sensitive logs. interval is only used by FsyncInterval policy.
+// With FsyncEveryRecord policy, buffered logs are also flushed after every record.
+// This method should be called before appender start to work.
+func (f *FileAppender) SetFsync(policy FsyncPolicy, interval time.Duration) {
+	f.fsyncPolicy = policy
+	if policy != FsyncInterval {
+		interval = 0
+	}
+	f.syncStop = restartTicker(f.syncStop, interval, func() {
+		if err := f.sync(); err != nil {
+			reportError("sync log file failed", err)
+		}
+	})
+}
+
+// SetEncryption encrypt log files with AES-256-GCM, in streamable chunks. A header with key id and random salt is
+// written at the start of log file, when appender starts and after rotating, and the data key is derived from the key
+// provided by keys and the salt, so every file has a fresh data key and nonce. Each write to file is sealed as
+// one chunk, enable buffered writing to reduce the overhead. A final chunk is written when closed and before rotating,
+// for detecting truncation, so Close should be called before program exit. Use NewDecryptReader to read the log files.
+// If SetHashChain is also used, this method should be called before SetHashChain.
+// An error is returned if the log file is not empty and not encrypted, rotate or move it first.
+// This method should be called before appender start to work.
+func (f *FileAppender) SetEncryption(keys KeyProvider) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if atomic.LoadInt32(&f.stderr) == 1 {
+		return errStderrWithFramedFile
+	}
+	if err := checkEncryptedFile(f.path); err != nil {
+		return err
+	}
+	e := &encrypter{keys: keys}
+	header, err := e.newSegment()
+	if err != nil {
+		return wrapError("init log file encryption error", err)
+	}
+	if err = f.writeRaw(header); err != nil {
+		return wrapError("write encryption header error", err)
+	}
+	f.encrypter = e
+	return nil
+}
+
+// check the log file is empty or encrypted, before appending encrypted segments
+func checkEncryptedFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return wrapError("check log file encryption error", err)
+	}
+	defer file.Close()
+	var head [1 + len(encryptMagic)]byte
+	n, err := io.ReadFull(file, head[:])
+	if n == 0 && err == io.EOF {
+		return nil
+	}
+	if n < len(head) || head[0] != frameHeader || string(head[1:]) != encryptMagic {
+		return errors.New("log file " + path + " is not empty and not encrypted, can not append encrypted logs")
+	}
+	return nil
+}
+
+// SetHashChain enable tamper-evident audit mode. Every record is written with a sequence number and a chaining hash,
+// which is HMAC-SHA256 of the previous hash, seq and the record, or SHA256 if key is empty.
+// A checkpoint is written at the end of file before rotating, and a continue entry at the start of new file,
+// so the chain spans rotated files. Use VerifyHashChain to verify log files.
+// If the log file already has records, the chain continues from the last one.
+// This method should be called before appender start to work.
+func (f *FileAppender) SetHashChain(key []byte) error {
+	if atomic.LoadInt32(&f.stderr) == 1 {
+		return errStderrWithFramedFile
+	}
+	chain := newHashChain(key)
+	var keys KeyProvider
+	if f.encrypter != nil {
+		keys = f.encrypter.keys
+	}
+	seq, sum, ok, err := lastChainStatus(f.path, keys)
+	if err != nil {
+		return wrapError("read hash chain of log file error", err)
+	}
+	if !ok {
+		// new file, continue from the newest rotated file if exists
+		if path := newestRotatedFile(f.path); path != "" {
+			if seq, sum, ok, err = lastChainStatus(path, keys); err != nil {
+				return wrapError("read hash chain of rotated log file error", err)
+			}
+			if ok {
+				chain.seq, chain.hash = seq, sum
+				if err = f.write(chain.appendMark(nil, chainContinue)); err != nil {
+					return wrapError("write hash chain continue entry error", err)
+				}
+			}
+		}
+	} else {
+		chain.seq, chain.hash = seq, sum
+	}
+	f.chain = chain
+	return nil
+}
+
+// the rotated log file modified last, empty if not found
+func newestRotatedFile(path string) string {
+	ext := filepath.Ext(path)
+	base := path[:len(path)-len(ext)]
+	var newest string
+	var newestTime time.Time
+	for _, suffix := range getLogSuffixed(path) {
+		rotated := base + "." + suffix + ext
+		if info, err := os.Stat(rotated); err == nil && info.ModTime().After(newestTime) {
+			newest, newestTime = rotated, info.ModTime()
+		}
+	}
+	return newest
+}
+
+// stop the old ticker goroutine if exists, and start a new one calling task every interval if interval > 0.
+// return the channel to stop the new goroutine
+func restartTicker(stop chan struct{}, interval time.Duration, task func()) chan struct{} {
+	if stop != nil {
+		close(stop)
+	}
+	if interval <= 0 {
+		return nil
+	}
+	stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				task()
+			case <-stop:
+				return
+			}
+		}
+	}(stop)
+	return stop
+}
+
 // Append append new log to file
 func (f *FileAppender) Append(event AppendEvent) error {
+	if f.bufferSize > 0 || f.fsyncPolicy != FsyncNever || f.chain != nil || f.encrypter != nil {
+		return f.appendLocked(event)
+	}
+	f.checkRotate(event, nil, nil)
+	_, err := f.currentFile().Write(event.Message)
+	return err
+}
+
+// append log with lock, for buffered writing, fsync, hash chain or encryption
+func (f *FileAppender) appendLocked(event AppendEvent) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return errFileAppenderClosed
+	}
+	f.checkRotate(event, func() {
+		// buffered logs and checkpoint should be written and synced to the old file
+		err := f.flushBuffer()
+		if err == nil && f.chain != nil {
+			err = f.write(f.chain.appendMark(nil, chainCheckpoint))
+		}
+		if err == nil {
+			err = f.finishSegment()
+		}
+		if err == nil && f.fsyncPolicy != FsyncNever {
+			err = f.syncFile()
+		}
+		if err != nil {
+			reportError("flush log file before rotating failed", err)
+		}
+	}, func() {
+		if f.encrypter != nil {
+			header, err := f.encrypter.newSegment()
+			if err == nil {
+				err = f.writeRaw(header)
+			}
+			if err != nil {
+				reportError("write encryption header failed", err)
+			}
+		}
+		if f.chain != nil {
+			if err := f.write(f.chain.appendMark(nil, chainContinue)); err != nil {
+				reportError("write hash chain continue entry failed", err)
+			}
+		}
+	})
+
+	data := event.Message
+	if f.chain != nil {
+		f.chainBuf = f.chain.appendRecord(f.chainBuf[:0], event.Message)
+		data = f.chainBuf
+	}
+	if f.bufferSize > 0 {
+		if len(f.buffer)+len(data) > f.bufferSize {
+			if err := f.flushBuffer(); err != nil {
+				return err
+			}
+		}
+		if len(data) > f.bufferSize {
+			if err := f.write(data); err != nil {
+				return err
+			}
+		} else {
+			f.buffer = append(f.buffer, data...)
+		}
+		if event.Level >= f.flushLevel || f.fsyncPolicy == FsyncEveryRecord {
+			if err := f.flushBuffer(); err != nil {
+				return err
+			}
+		}
+	} else if err := f.write(data); err != nil {
+		return err
+	}
+
+	if f.fsyncPolicy == FsyncEveryRecord {
+		return f.syncFile()
+	}
+	return nil
+}
+
+// Flush write buffered logs to file, and call fsync if fsync policy is not FsyncNever
+func (f *FileAppender) Flush() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return nil
+	}
+	if err := f.flushBuffer(); err != nil {
+		return err
+	}
+	if f.fsyncPolicy != FsyncNever {
+		return f.syncFile()
+	}
+	return nil
+}
+
+// Close flush buffered logs, and close the log file. Logs appended after closed would fail.
+func (f *FileAppender) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.flushStop = restartTicker(f.flushStop, 0, nil)
+	f.syncStop = restartTicker(f.syncStop, 0, nil)
+	err := f.flushBuffer()
+	if err == nil {
+		err = f.finishSegment()
+	}
+	if err == nil && f.fsyncPolicy != FsyncNever {
+		err = f.syncFile()
+	}
+	if closeErr := f.currentFile().Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// call fsync if there are logs written but not synced
+func (f *FileAppender) sync() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return nil
+	}
+	return f.syncFile()
+}
+
+// write buffered logs to file, should be called with lock held
+func (f *FileAppender) flushBuffer() error {
+	if len(f.buffer) == 0 {
+		return nil
+	}
+	err := f.write(f.buffer)
+	f.buffer = f.buffer[:0]
+	return err
+}
+
+// write data to file, encrypt data if encryption is enabled. Should be called with lock held
+func (f *FileAppender) write(data []byte) error {
+	if f.encrypter != nil {
+		f.encryptBuf = f.encrypter.appendChunk(f.encryptBuf[:0], data)
+		data = f.encryptBuf
+	}
+	return f.writeRaw(data)
+}
+
+// write the final chunk of encryption segment if encryption is enabled. Should be called with lock held
+func (f *FileAppender) finishSegment() error {
+	if f.encrypter == nil {
+		return nil
+	}
+	f.encryptBuf = f.encrypter.appendFinal(f.encryptBuf[:0])
+	return f.writeRaw(f.encryptBuf)
+}
+
+// write data to file as it is, should be called with lock held
+func (f *FileAppender) writeRaw(data []byte) error {
+	_, err := f.currentFile().Write(data)
+	f.unsynced = true
+	return err
+}
+
+// call fsync if there are unsynced logs, should be called with lock held
+func (f *FileAppender) syncFile() error {
+	if !f.unsynced {
+		return nil
+	}
+	f.unsynced = false
+	return f.currentFile().Sync()
+}
+
+// rotate log file if needed. beforeRotate is called before rotating, and afterRotate is called after rotated,
+// if they are not nil
+func (f *FileAppender) checkRotate(event AppendEvent, beforeRotate func(), afterRotate func()) {
 	if f.rotater != nil {
 		shouldRotate, suffix := f.rotater.Check(time.Now(), len(event.Message), 1)
 		if shouldRotate {
+			if beforeRotate != nil {
+				beforeRotate()
+			}
 			//rotate
 			ext := filepath.Ext(f.path)
 			base := f.path[:len(f.path)-len(ext)]
@@ -64,12 +438,29 @@ func (f *FileAppender) Append(event AppendEvent) error {
 			if err != nil {
 				// rotate failed, still use the current file?
 				print("rotate failed, stopping writing")
+			} else if afterRotate != nil {
+				afterRotate()
 			}
 		}
 	}
+}
 
-	_, err := f.currentFile().WriteString(event.Message)
-	return err
+// RedirectStderr redirect the stderr of process to the log file, so the crash output of go runtime,
+// such as unrecovered panics and fatal errors, and other output written to stderr, are kept in log file.
+// The redirection follows the log file when it is rotated. Only supported on unix platforms.
+// Can not be used with SetEncryption or SetHashChain, as raw stderr output would break the file format.
+func (f *FileAppender) RedirectStderr() error {
+	f.lock.Lock()
+	framed := f.chain != nil || f.encrypter != nil
+	f.lock.Unlock()
+	if framed {
+		return errStderrWithFramedFile
+	}
+	if err := redirectStderr(f.currentFile()); err != nil {
+		return wrapError("redirect stderr to log file error", err)
+	}
+	atomic.StoreInt32(&f.stderr, 1)
+	return nil
 }
 
 func (f *FileAppender) currentFile() *os.File {
@@ -93,6 +484,11 @@ func (f *FileAppender) rotateFile(renamePath string) error {
 	}
 	oldFile := f.currentFile()
 	if f.swapFile(oldFile, file) {
+		if atomic.LoadInt32(&f.stderr) == 1 {
+			if err := redirectStderr(file); err != nil {
+				reportError("redirect stderr to rotated log file error", err)
+			}
+		}
 		oldFile.Close()
 	} else {
 		//should not happen if appender act rightly ?
@@ -102,32 +498,50 @@ func (f *FileAppender) rotateFile(renamePath string) error {
 	return nil
 }
 
-func getLogSuffixed(path string) []string {
+// rotatedLogFile is a rotated file of log file, named as base.suffix.ext, or base.suffix.ext.gz if gzipped
+type rotatedLogFile struct {
+	path   string
+	suffix string
+}
+
+// the rotated files of log file in its dir, in the order of dir entries
+func rotatedLogFiles(path string) []rotatedLogFile {
 	dir, filename := filepath.Split(path)
 	extension := filepath.Ext(filename)
 	baseName := filename[:len(filename)-len(extension)]
-	files, _ := ioutil.ReadDir(dir)
+	files, _ := ioutil.ReadDir(dirOrCurrent(dir))
 
-	var suffixes []string
+	var rotated []rotatedLogFile
 	for _, f := range files {
 		logFileName := f.Name()
-		if !strings.HasPrefix(logFileName, baseName) {
-			continue
-		}
-		remain := logFileName[len(baseName):]
-		if len(remain) == 0 {
+		if f.IsDir() || !strings.HasPrefix(logFileName, baseName+".") {
 			continue
 		}
-		idx := strings.Index(remain, extension)
-		if idx <= 1 {
+		remain := strings.TrimSuffix(logFileName[len(baseName)+1:], ".gz")
+		if !strings.HasSuffix(remain, extension) || len(remain) == len(extension) {
 			continue
 		}
-		suffix := remain[1:idx]
-		suffixes = append(suffixes, suffix)
+		suffix := remain[:len(remain)-len(extension)]
+		rotated = append(rotated, rotatedLogFile{path: filepath.Join(dir, logFileName), suffix: suffix})
+	}
+	return rotated
+}
+
+func getLogSuffixed(path string) []string {
+	var suffixes []string
+	for _, rotated := range rotatedLogFiles(path) {
+		suffixes = append(suffixes, rotated.suffix)
 	}
 	return suffixes
 }
 
+func dirOrCurrent(dir string) string {
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
+
 // Rotater interface for log rotate
 type Rotater interface {
 	// tell rotater init log file status, so rotater can determine when and how to do next rotate.
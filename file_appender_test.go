@@ -2,7 +2,9 @@ package vlog
 
 import (
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -12,7 +14,7 @@ func TestFileAppender_Write(t *testing.T) {
 	assert.NoError(t, err)
 	defer os.Remove("test_file.log")
 
-	err = appender.Append(AppendEvent{"", Debug, "This is a test\n"})
+	err = appender.Append(AppendEvent{"", Debug, []byte("This is a test\n")})
 	assert.Nil(t, err)
 }
 
@@ -21,7 +23,7 @@ func TestFileAppender_Write2(t *testing.T) {
 	defer os.RemoveAll("multi/")
 	assert.NoError(t, err)
 
-	err = appender.Append(AppendEvent{"", Debug, "This is a test\n"})
+	err = appender.Append(AppendEvent{"", Debug, []byte("This is a test\n")})
 	assert.Nil(t, err)
 }
 
@@ -36,6 +38,11 @@ func TestGetLogSuffixes(t *testing.T) {
 	f2.Close()
 	f3, _ := openFile("multi/path/test_file.201457.log.gz")
 	f3.Close()
+	// other log files with the same prefix
+	f5, _ := openFile("multi/path/test_file2.1.log")
+	f5.Close()
+	f6, _ := openFile("multi/path/test_file.201458.log.bak")
+	f6.Close()
 
 	suffixes := getLogSuffixed("multi/path/test_file.log")
 	assert.Equal(t, []string{"201456", "201457"}, suffixes)
@@ -44,7 +51,7 @@ func TestGetLogSuffixes(t *testing.T) {
 func TestLogRotate(t *testing.T) {
 	defer os.RemoveAll("logs/")
 	appender, err := NewFileAppender("logs/test_file.log", nil)
-	appender.Append(AppendEvent{"", Debug, "first log\n"})
+	appender.Append(AppendEvent{"", Debug, []byte("first log\n")})
 	assert.NoError(t, err)
 	appender.rotateFile("logs/test_file.1234.log")
 
@@ -88,3 +95,86 @@ func TestSizeRotater(t *testing.T) {
 	assert.True(t, b)
 	assert.Equal(t, "00124", s)
 }
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestFileAppender_Buffer(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "buffered.log")
+	appender, err := NewFileAppender(path, nil)
+	assert.NoError(t, err)
+	appender.SetBuffer(16, 0, Error)
+
+	assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("info1\n")}))
+	assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("info2\n")}))
+	assert.Equal(t, "", readFile(t, path))
+
+	// buffer full
+	assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("info3\n")}))
+	assert.Equal(t, "info1\ninfo2\n", readFile(t, path))
+
+	// level triggered
+	assert.NoError(t, appender.Append(AppendEvent{Level: Error, Message: []byte("error\n")}))
+	assert.Equal(t, "info1\ninfo2\ninfo3\nerror\n", readFile(t, path))
+
+	// larger than buffer
+	assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("a long long message\n")}))
+	assert.Equal(t, "info1\ninfo2\ninfo3\nerror\na long long message\n", readFile(t, path))
+
+	assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("last\n")}))
+	assert.NoError(t, appender.Close())
+	assert.Equal(t, "info1\ninfo2\ninfo3\nerror\na long long message\nlast\n", readFile(t, path))
+	assert.Equal(t, errFileAppenderClosed, appender.Append(AppendEvent{Level: Info, Message: []byte("closed\n")}))
+}
+
+func TestFileAppender_FlushInterval(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "interval.log")
+	appender, err := NewFileAppender(path, nil)
+	assert.NoError(t, err)
+	defer appender.Close()
+	appender.SetBuffer(4096, 10*time.Millisecond, Off)
+	appender.SetFsync(FsyncInterval, 10*time.Millisecond)
+
+	assert.NoError(t, appender.Append(AppendEvent{Level: Critical, Message: []byte("message\n")}))
+	assert.Equal(t, "", readFile(t, path))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, "message\n", readFile(t, path))
+}
+
+func TestFileAppender_FsyncEveryRecord(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fsync.log")
+	appender, err := NewFileAppender(path, nil)
+	assert.NoError(t, err)
+	defer appender.Close()
+	appender.SetBuffer(4096, 0, Off)
+	appender.SetFsync(FsyncEveryRecord, 0)
+
+	assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("message\n")}))
+	assert.Equal(t, "message\n", readFile(t, path))
+	assert.False(t, appender.unsynced)
+}
+
+func TestFileAppender_BufferRotate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rotate.log")
+	appender, err := NewFileAppender(path, NewSizeRotater(10, 1))
+	assert.NoError(t, err)
+	appender.SetBuffer(4096, 0, Off)
+
+	assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("first\n")}))
+	assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("second\n")}))
+	assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("third\n")}))
+	assert.NoError(t, appender.Close())
+	assert.Equal(t, "first\n", readFile(t, filepath.Join(dir, "rotate.1.log")))
+	assert.Equal(t, "second\nthird\n", readFile(t, path))
+}
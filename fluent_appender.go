@@ -0,0 +1,275 @@
+package vlog
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+var _ Transformer = (*FluentTransformer)(nil)
+
+// FluentTransformer transform log record to msgpack encoded fluentd entry: [time, record].
+// The transformed messages should be sent by FluentAppender, they are not readable text.
+//
+// The record map contains keys: logger, level, message, and package/file/function/line if caller is enabled.
+// Fields are put into the record map with their keys, field keys conflict with the keys above are prefixed with "field.".
+type FluentTransformer struct {
+	withCaller bool
+}
+
+// NewFluentTransformer create fluent transformer. If withCaller is true, the caller package/file/function/line are included.
+func NewFluentTransformer(withCaller bool) *FluentTransformer {
+	return &FluentTransformer{withCaller: withCaller}
+}
+
+// Transform convert log record to msgpack encoded fluentd entry
+func (t *FluentTransformer) Transform(record LogRecord) AppendEvent {
+	var size = 3 + len(record.Fields)
+	if t.withCaller {
+		size += 4
+	}
+	var buf = make([]byte, 0, 128+len(record.Message))
+	buf = appendMsgpackArrayHeader(buf, 2)
+	buf = appendMsgpackEventTime(buf, record.LogTime)
+	buf = appendMsgpackMapHeader(buf, size)
+	buf = appendMsgpackString(buf, "logger")
+	buf = appendMsgpackString(buf, record.LoggerName)
+	buf = appendMsgpackString(buf, "level")
+	buf = appendMsgpackString(buf, record.Level.Name())
+	buf = appendMsgpackString(buf, "message")
+	buf = appendMsgpackString(buf, record.Message)
+	if t.withCaller {
+		caller := getRecordCaller(&record, transformCallerDepth+record.callerSkip)
+		buf = appendMsgpackString(buf, "package")
+		buf = appendMsgpackString(buf, caller.packageName)
+		buf = appendMsgpackString(buf, "file")
+		buf = appendMsgpackString(buf, caller.fileName)
+		buf = appendMsgpackString(buf, "function")
+		buf = appendMsgpackString(buf, caller.functionName)
+		buf = appendMsgpackString(buf, "line")
+		buf = appendMsgpackInt(buf, int64(caller.line))
+	}
+	for _, field := range record.Fields {
+		key := field.Key
+		if jsonReservedKeys[key] {
+			key = "field." + key
+		}
+		buf = appendMsgpackString(buf, key)
+		buf = appendMsgpackValue(buf, field.Value)
+	}
+	return AppendEvent{LoggerName: record.LoggerName, Level: record.Level, Message: buf}
+}
+
+// default batch settings for FluentAppender
+const (
+	DefaultFluentBatchCount   = 500
+	DefaultFluentBatchBytes   = 512 * 1024
+	DefaultFluentBatchLatency = 200 * time.Millisecond
+)
+
+var _ Appender = (*FluentAppender)(nil)
+var _ Flusher = (*FluentAppender)(nil)
+
+// FluentAppender send log to fluentd or fluent bit, using Fluent Forward protocol, in forward mode.
+// Events are sent in batches, events of one batch are grouped into forward messages by tag.
+// The tag is tagPrefix + "." + logger name, the '/' in logger name is replaced by '.'.
+// Append never waits for sending: when too many batches are waiting, new batches are dropped, and counted by Dropped.
+//
+// The transformer of FluentAppender is a FluentTransformer without caller by default.
+// Close should be called before program exit, to send the pending events.
+type FluentAppender struct {
+	*CanFormattedMixin
+	network    string
+	address    string
+	tagPrefix  string
+	ack        bool
+	ackTimeout time.Duration
+	maxRetries int
+	conn       net.Conn
+	reader     *bufio.Reader
+	batcher    *batcher
+}
+
+// NewFluentAppender create fluent appender, connect to fluentd forward input.
+// network can be tcp or unix, address is host:port for tcp, or socket path for unix.
+func NewFluentAppender(network string, address string, tagPrefix string) (*FluentAppender, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, wrapError("connect to fluent forward input failed", err)
+	}
+	appender := &FluentAppender{
+		CanFormattedMixin: NewAppenderMixin(),
+		network:           network,
+		address:           address,
+		tagPrefix:         tagPrefix,
+		maxRetries:        3,
+		conn:              conn,
+		reader:            bufio.NewReader(conn),
+	}
+	appender.SetTransformer(NewFluentTransformer(false))
+	appender.batcher = newBatcher(DefaultFluentBatchCount, DefaultFluentBatchBytes, DefaultFluentBatchLatency, appender.send, nil, nil)
+	return appender, nil
+}
+
+// SetAck enable at-least-once delivery: send chunk id with every forward message, and wait the server ack the chunk.
+// A message not acked in timeout is resent.
+// This method should be called before appender start to work.
+func (f *FluentAppender) SetAck(timeout time.Duration) {
+	f.ack = true
+	f.ackTimeout = timeout
+}
+
+// SetRetry set the max retry times of sending one forward message, reconnect before every retry.
+// This method should be called before appender start to work.
+func (f *FluentAppender) SetRetry(maxRetries int) {
+	f.maxRetries = maxRetries
+}
+
+// SetBatch set the max count, total message bytes and latency of one batch.
+// zero or negative value means no limit for this dimension.
+func (f *FluentAppender) SetBatch(maxCount int, maxBytes int, maxLatency time.Duration) {
+	f.batcher.setLimits(maxCount, maxBytes, maxLatency)
+}
+
+// Dropped return the count of events dropped, as too many batches are waiting to be sent
+func (f *FluentAppender) Dropped() int64 {
+	return f.batcher.droppedCount()
+}
+
+// Append add event to batch
+func (f *FluentAppender) Append(event AppendEvent) error {
+	return f.batcher.add(event)
+}
+
+// Flush send pending events, and wait until they are sent
+func (f *FluentAppender) Flush() error {
+	f.batcher.flush()
+	return nil
+}
+
+// Close send pending events and close the connection
+func (f *FluentAppender) Close() error {
+	f.batcher.close()
+	if f.conn != nil {
+		err := f.conn.Close()
+		f.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (f *FluentAppender) tag(loggerName string) string {
+	name := strings.Replace(loggerName, "/", ".", -1)
+	if f.tagPrefix == "" {
+		return name
+	}
+	if name == "" {
+		return f.tagPrefix
+	}
+	return f.tagPrefix + "." + name
+}
+
+// send forward messages, grouped by tag. called only in batcher goroutine
+func (f *FluentAppender) send(entries []batchEntry) {
+	var tags []string
+	var tagEntries = map[string][]batchEntry{}
+	for _, entry := range entries {
+		tag := f.tag(entry.event.LoggerName)
+		if _, ok := tagEntries[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		tagEntries[tag] = append(tagEntries[tag], entry)
+	}
+
+	for _, tag := range tags {
+		entries := tagEntries[tag]
+		var chunk string
+		if f.ack {
+			var id = make([]byte, 16)
+			_, _ = rand.Read(id)
+			chunk = base64.StdEncoding.EncodeToString(id)
+		}
+		message := f.forwardMessage(tag, entries, chunk)
+		if err := f.sendWithRetry(message, chunk); err != nil {
+			reportError("send fluent forward message error", err)
+		}
+	}
+}
+
+// encode forward mode message: [tag, [entry...], option]
+func (f *FluentAppender) forwardMessage(tag string, entries []batchEntry, chunk string) []byte {
+	var size = 0
+	for _, entry := range entries {
+		size += len(entry.event.Message)
+	}
+	var buf = make([]byte, 0, size+len(tag)+64)
+	buf = appendMsgpackArrayHeader(buf, 3)
+	buf = appendMsgpackString(buf, tag)
+	buf = appendMsgpackArrayHeader(buf, len(entries))
+	for _, entry := range entries {
+		buf = append(buf, entry.event.Message...)
+	}
+	if chunk == "" {
+		buf = appendMsgpackMapHeader(buf, 1)
+	} else {
+		buf = appendMsgpackMapHeader(buf, 2)
+		buf = appendMsgpackString(buf, "chunk")
+		buf = appendMsgpackString(buf, chunk)
+	}
+	buf = appendMsgpackString(buf, "size")
+	buf = appendMsgpackInt(buf, int64(len(entries)))
+	return buf
+}
+
+func (f *FluentAppender) sendWithRetry(message []byte, chunk string) error {
+	var err error
+	for retry := 0; retry <= f.maxRetries; retry++ {
+		if retry > 0 || f.conn == nil {
+			if err = f.reconnect(); err != nil {
+				continue
+			}
+		}
+		if err = f.sendOnce(message, chunk); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (f *FluentAppender) sendOnce(message []byte, chunk string) error {
+	if _, err := f.conn.Write(message); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+	if err := f.conn.SetReadDeadline(time.Now().Add(f.ackTimeout)); err != nil {
+		return err
+	}
+	response, err := readMsgpackStringMap(f.reader)
+	if err != nil {
+		return wrapError("read fluent ack failed", err)
+	}
+	if response["ack"] != chunk {
+		return errors.New("fluent ack mismatch, expect " + chunk + ", got " + response["ack"])
+	}
+	return nil
+}
+
+func (f *FluentAppender) reconnect() error {
+	if f.conn != nil {
+		_ = f.conn.Close()
+		f.conn = nil
+	}
+	conn, err := net.Dial(f.network, f.address)
+	if err != nil {
+		return wrapError("reconnect to fluent forward input failed", err)
+	}
+	f.conn = conn
+	f.reader = bufio.NewReader(conn)
+	return nil
+}
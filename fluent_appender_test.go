@@ -0,0 +1,174 @@
+package vlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// decode msgpack value, for the types vlog encodes
+func decodeMsgpack(t *testing.T, r *bufio.Reader) interface{} {
+	b, err := r.ReadByte()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readN := func(n int) []byte {
+		var data = make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	readArray := func(n int) []interface{} {
+		var values = make([]interface{}, n)
+		for i := range values {
+			values[i] = decodeMsgpack(t, r)
+		}
+		return values
+	}
+	readMap := func(n int) map[string]interface{} {
+		var m = make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			m[decodeMsgpack(t, r).(string)] = decodeMsgpack(t, r)
+		}
+		return m
+	}
+	switch {
+	case b < 0x80:
+		return int64(b)
+	case b >= 0xe0:
+		return int64(int8(b))
+	case b&0xf0 == 0x80:
+		return readMap(int(b & 0x0f))
+	case b&0xf0 == 0x90:
+		return readArray(int(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		return string(readN(int(b & 0x1f)))
+	}
+	switch b {
+	case 0xc0:
+		return nil
+	case 0xc2:
+		return false
+	case 0xc3:
+		return true
+	case 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(readN(8)))
+	case 0xcf:
+		return int64(binary.BigEndian.Uint64(readN(8)))
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(readN(8)))
+	case 0xd7:
+		data := readN(9)
+		return time.Unix(int64(binary.BigEndian.Uint32(data[1:5])), int64(binary.BigEndian.Uint32(data[5:])))
+	case 0xd9:
+		return string(readN(int(readN(1)[0])))
+	case 0xda:
+		return string(readN(int(binary.BigEndian.Uint16(readN(2)))))
+	case 0xdc:
+		return readArray(int(binary.BigEndian.Uint16(readN(2))))
+	case 0xde:
+		return readMap(int(binary.BigEndian.Uint16(readN(2))))
+	}
+	t.Fatalf("unexpected msgpack type: %x", b)
+	return nil
+}
+
+// start a fluent forward server, decode forward messages and send to channel
+func startFluentServer(t *testing.T, network string, address string, ack bool) (net.Listener, chan []interface{}) {
+	listener, err := net.Listen(network, address)
+	assert.NoError(t, err)
+	var messages = make(chan []interface{}, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					if _, err := reader.Peek(1); err != nil {
+						return
+					}
+					message := decodeMsgpack(t, reader).([]interface{})
+					messages <- message
+					if ack {
+						option := message[2].(map[string]interface{})
+						var buf = appendMsgpackMapHeader(nil, 1)
+						buf = appendMsgpackString(buf, "ack")
+						buf = appendMsgpackString(buf, option["chunk"].(string))
+						_, _ = conn.Write(buf)
+					}
+				}
+			}()
+		}
+	}()
+	return listener, messages
+}
+
+func TestFluentAppender_Forward(t *testing.T) {
+	listener, messages := startFluentServer(t, "tcp", "127.0.0.1:0", false)
+	defer listener.Close()
+
+	appender, err := NewFluentAppender("tcp", listener.Addr().String(), "app")
+	assert.NoError(t, err)
+	appender.SetTransformer(NewFluentTransformer(true))
+	logger := GetLogger("github.com/user/fluent")
+	logger.SetAppenders(appender)
+	logger.Info("first", F("count", 2), F("ratio", 0.5))
+	logger.Warn("second\nline")
+	assert.NoError(t, appender.Close())
+
+	message := <-messages
+	assert.Equal(t, "app.github.com.user.fluent", message[0])
+	entries := message[1].([]interface{})
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, map[string]interface{}{"size": int64(2)}, message[2])
+
+	first := entries[0].([]interface{})
+	assert.IsType(t, time.Time{}, first[0])
+	record := first[1].(map[string]interface{})
+	assert.Equal(t, "first", record["message"])
+	assert.Equal(t, "Info", record["level"])
+	assert.Equal(t, "github.com/user/fluent", record["logger"])
+	assert.Equal(t, int64(2), record["count"])
+	assert.Equal(t, 0.5, record["ratio"])
+	assert.Equal(t, "fluent_appender_test.go", record["file"])
+	second := entries[1].([]interface{})[1].(map[string]interface{})
+	assert.Equal(t, "second\nline", second["message"])
+}
+
+func TestFluentAppender_Ack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vlog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "fluent.sock")
+	listener, messages := startFluentServer(t, "unix", socket, true)
+	defer listener.Close()
+
+	appender, err := NewFluentAppender("unix", socket, "")
+	assert.NoError(t, err)
+	appender.SetAck(time.Second)
+	appender.SetBatch(1, 0, 0)
+	assert.NoError(t, appender.Append(AppendEvent{LoggerName: "l1", Level: Info,
+		Message: NewFluentTransformer(false).Transform(LogRecord{LoggerName: "l1", Message: "m1"}).Message}))
+	assert.NoError(t, appender.Flush())
+	assert.NoError(t, appender.Close())
+
+	message := <-messages
+	assert.Equal(t, "l1", message[0])
+	option := message[2].(map[string]interface{})
+	assert.Equal(t, int64(1), option["size"])
+	assert.NotEmpty(t, option["chunk"])
+}
@@ -0,0 +1,307 @@
+package vlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var _ Transformer = (*GELFTransformer)(nil)
+
+// gelfLevelMap map vlog levels to syslog severities, which GELF use as level
+var gelfLevelMap = map[Level]int{
+	Trace:    7,
+	Debug:    7,
+	Info:     6,
+	Warn:     4,
+	Error:    3,
+	Critical: 2,
+}
+
+// GELFTransformer transform log record to GELF 1.1 json message, for Graylog.
+//
+// The first line of log message is sent as short_message, and the whole message is sent as full_message if the message
+// has multi lines. The logger name, caller and fields are sent as additional fields:
+// _logger, _package, _file, _function, _line, and _{field key}.
+type GELFTransformer struct {
+	host         string
+	staticFields map[string]interface{}
+}
+
+// NewGELFTransformer create GELF transformer.
+// host is the host name sent to Graylog, if is empty, use the host name of current machine.
+// staticFields are additional fields sent with every log message, such as app name or environment.
+func NewGELFTransformer(host string, staticFields ...Field) *GELFTransformer {
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	var fields = make(map[string]interface{}, len(staticFields))
+	for _, field := range staticFields {
+		fields[gelfFieldName(field.Key)] = fieldValue(field.Value)
+	}
+	return &GELFTransformer{host: host, staticFields: fields}
+}
+
+// Transform convert log record to GELF json message
+func (t *GELFTransformer) Transform(record LogRecord) AppendEvent {
+	caller := getRecordCaller(&record, transformCallerDepth+record.callerSkip)
+
+	var m = make(map[string]interface{}, len(t.staticFields)+len(record.Fields)+10)
+	for key, value := range t.staticFields {
+		m[key] = value
+	}
+	for _, field := range record.Fields {
+		m[gelfFieldName(field.Key)] = fieldValue(field.Value)
+	}
+	m["_logger"] = record.LoggerName
+	m["_package"] = caller.packageName
+	m["_file"] = caller.fileName
+	m["_function"] = caller.functionName
+	m["_line"] = caller.line
+
+	m["version"] = "1.1"
+	m["host"] = t.host
+	m["timestamp"] = float64(record.LogTime.UnixNano()/int64(1000)) / 1e6
+	if level, ok := gelfLevelMap[record.Level]; ok {
+		m["level"] = level
+	}
+	if idx := strings.IndexByte(record.Message, '\n'); idx >= 0 {
+		m["short_message"] = record.Message[:idx]
+		m["full_message"] = record.Message
+	} else {
+		m["short_message"] = record.Message
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		// should not happen, all values are converted by fieldValue
+		data = []byte(`{"version":"1.1","host":` + strconv.Quote(t.host) + `,"short_message":` +
+			strconv.Quote("marshal gelf message failed: "+err.Error()) + `}`)
+	}
+	return AppendEvent{LoggerName: record.LoggerName, Level: record.Level, Message: data}
+}
+
+// gelfFieldName convert key to a valid GELF additional field name, which should match ^_[\w\.\-]*$ and is not _id
+func gelfFieldName(key string) string {
+	var sb strings.Builder
+	sb.WriteByte('_')
+	for _, r := range key {
+		if r == '_' || r == '.' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	name := sb.String()
+	if name == "_id" {
+		return "_id_"
+	}
+	return name
+}
+
+// GELFCompression the compression type used by GELFAppender when send log via udp
+type GELFCompression int
+
+// GELF compression types
+const (
+	GELFNoCompression GELFCompression = 0
+	GELFGzip          GELFCompression = 1
+	GELFZlib          GELFCompression = 2
+)
+
+const (
+	gelfChunkHeaderSize = 12
+	gelfMaxChunks       = 128
+	// DefaultGELFChunkSize is the default max udp packet size for GELFAppender, recommended by Graylog for WAN
+	DefaultGELFChunkSize = 1420
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+var _ Appender = (*GELFAppender)(nil)
+
+// GELFAppender send log to Graylog, using GELF udp or tcp input.
+// The transformer of GELFAppender is a GELFTransformer with the local host name by default,
+// set another GELFTransformer if need static additional fields.
+//
+// For udp, the message is compressed if compression is set, and split into chunks if the message is too large.
+// For tcp, the message is not compressed, and is terminated with a null byte.
+type GELFAppender struct {
+	*CanFormattedMixin
+	network     string
+	address     string
+	compression GELFCompression
+	chunkSize   int
+	conn        net.Conn
+	closed      bool
+	lock        sync.Mutex
+}
+
+var errGELFAppenderClosed = errors.New("gelf appender is closed")
+
+// NewGELFUDPAppender create GELF appender which send log to address via udp
+func NewGELFUDPAppender(address string, compression GELFCompression) (*GELFAppender, error) {
+	return newGELFAppender("udp", address, compression)
+}
+
+// NewGELFTCPAppender create GELF appender which send log to address via tcp
+func NewGELFTCPAppender(address string) (*GELFAppender, error) {
+	return newGELFAppender("tcp", address, GELFNoCompression)
+}
+
+func newGELFAppender(network string, address string, compression GELFCompression) (*GELFAppender, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, wrapError("connect to gelf input failed", err)
+	}
+	appender := &GELFAppender{
+		CanFormattedMixin: NewAppenderMixin(),
+		network:           network,
+		address:           address,
+		compression:       compression,
+		chunkSize:         DefaultGELFChunkSize,
+		conn:              conn,
+	}
+	appender.SetTransformer(NewGELFTransformer(""))
+	return appender, nil
+}
+
+// SetChunkSize set the max udp packet size, larger messages are split into chunks.
+// This method should be called before appender start to work.
+func (g *GELFAppender) SetChunkSize(chunkSize int) {
+	if chunkSize <= gelfChunkHeaderSize {
+		chunkSize = DefaultGELFChunkSize
+	}
+	g.chunkSize = chunkSize
+}
+
+// Append send one GELF message
+func (g *GELFAppender) Append(event AppendEvent) error {
+	if g.network == "tcp" {
+		return g.writeTCP(append(event.Message, 0))
+	}
+
+	data, err := g.compress(event.Message)
+	if err != nil {
+		return wrapError("compress gelf message failed", err)
+	}
+	conn := g.currentConn()
+	if conn == nil {
+		return errGELFAppenderClosed
+	}
+	if len(data) <= g.chunkSize {
+		_, err = conn.Write(data)
+		return err
+	}
+	return g.writeChunks(conn, data)
+}
+
+func (g *GELFAppender) compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch g.compression {
+	case GELFNoCompression:
+		return data, nil
+	case GELFGzip:
+		writer = gzip.NewWriter(&buffer)
+	case GELFZlib:
+		writer = zlib.NewWriter(&buffer)
+	default:
+		return nil, errors.New("unknown gelf compression: " + strconv.Itoa(int(g.compression)))
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (g *GELFAppender) writeChunks(conn net.Conn, data []byte) error {
+	bodySize := g.chunkSize - gelfChunkHeaderSize
+	count := (len(data) + bodySize - 1) / bodySize
+	if count > gelfMaxChunks {
+		return errors.New("gelf message too large, need " + strconv.Itoa(count) + " chunks")
+	}
+	var messageID = make([]byte, 8)
+	if _, err := rand.Read(messageID); err != nil {
+		return wrapError("generate gelf message id failed", err)
+	}
+
+	var chunk = make([]byte, 0, g.chunkSize)
+	for seq := 0; seq < count; seq++ {
+		end := (seq + 1) * bodySize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk = append(chunk[:0], gelfChunkMagic...)
+		chunk = append(chunk, messageID...)
+		chunk = append(chunk, byte(seq), byte(count))
+		chunk = append(chunk, data[seq*bodySize:end]...)
+		if _, err := conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write data to tcp connection, reconnect and retry once if write failed
+func (g *GELFAppender) writeTCP(data []byte) error {
+	conn := g.currentConn()
+	if conn != nil {
+		if _, err := conn.Write(data); err == nil {
+			return nil
+		}
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.closed {
+		return errGELFAppenderClosed
+	}
+	if g.conn != conn && g.conn != nil {
+		// already reconnected by others
+		_, err := g.conn.Write(data)
+		return err
+	}
+	if g.conn != nil {
+		_ = g.conn.Close()
+		g.conn = nil
+	}
+	newConn, err := net.Dial(g.network, g.address)
+	if err != nil {
+		return wrapError("reconnect to gelf input failed", err)
+	}
+	g.conn = newConn
+	_, err = newConn.Write(data)
+	return err
+}
+
+func (g *GELFAppender) currentConn() net.Conn {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.conn
+}
+
+// Close the connection to Graylog
+func (g *GELFAppender) Close() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.closed = true
+	if g.conn == nil {
+		return nil
+	}
+	err := g.conn.Close()
+	g.conn = nil
+	return err
+}
@@ -0,0 +1,148 @@
+package vlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGELFTransformer_Transform(t *testing.T) {
+	transformer := NewGELFTransformer("test-host", F("app", "vlog"))
+	ts := time.Unix(1500000000, 123000000)
+	event := transformer.Transform(LogRecord{
+		LoggerName: "test",
+		Level:      Warn,
+		LogTime:    ts,
+		Message:    "first line\nsecond line",
+		Fields:     []Field{F("user id", 10), F("id", "x")},
+	})
+	assert.Equal(t, Warn, event.Level)
+
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(event.Message, &m))
+	assert.Equal(t, "1.1", m["version"])
+	assert.Equal(t, "test-host", m["host"])
+	assert.Equal(t, "first line", m["short_message"])
+	assert.Equal(t, "first line\nsecond line", m["full_message"])
+	assert.Equal(t, 1500000000.123, m["timestamp"])
+	assert.Equal(t, float64(4), m["level"])
+	assert.Equal(t, "test", m["_logger"])
+	assert.Equal(t, "vlog", m["_app"])
+	assert.Equal(t, float64(10), m["_user_id"])
+	assert.Equal(t, "x", m["_id_"])
+}
+
+func readGELFUDP(t *testing.T, conn net.PacketConn) []byte {
+	var buf = make([]byte, 65536)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	return buf[:n]
+}
+
+func TestGELFAppender_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	appender, err := NewGELFUDPAppender(conn.LocalAddr().String(), GELFGzip)
+	assert.NoError(t, err)
+	defer appender.Close()
+	logger := GetLogger("gelf_udp_test")
+	logger.SetAppenders(appender)
+	logger.Error("test message", F("key", "value"))
+
+	reader, err := gzip.NewReader(bytes.NewReader(readGELFUDP(t, conn)))
+	assert.NoError(t, err)
+	data, _ := ioutil.ReadAll(reader)
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &m))
+	assert.Equal(t, "test message", m["short_message"])
+	assert.Equal(t, float64(3), m["level"])
+	assert.Equal(t, "value", m["_key"])
+	assert.Equal(t, "gelf_appender_test.go", m["_file"])
+	assert.Equal(t, "TestGELFAppender_UDP", m["_function"])
+}
+
+func TestGELFAppender_UDPChunked(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	appender, err := NewGELFUDPAppender(conn.LocalAddr().String(), GELFZlib)
+	assert.NoError(t, err)
+	defer appender.Close()
+	appender.SetChunkSize(100)
+
+	var sb strings.Builder
+	for i := 0; sb.Len() < 4000; i++ {
+		sb.WriteString(time.Unix(int64(i)*7919, 0).String())
+	}
+	message := sb.String()
+	event := appender.Transformer().Transform(LogRecord{LoggerName: "test", Level: Info, LogTime: time.Now(), Message: message})
+	assert.NoError(t, appender.Append(event))
+
+	var chunks [][]byte
+	var count = -1
+	for count < 0 || len(chunks) < count {
+		packet := readGELFUDP(t, conn)
+		if !assert.True(t, len(packet) > 12 && len(packet) <= 100) {
+			return
+		}
+		assert.Equal(t, []byte{0x1e, 0x0f}, packet[:2])
+		if count < 0 {
+			count = int(packet[11])
+			chunks = make([][]byte, 0, count)
+		}
+		assert.Equal(t, len(chunks), int(packet[10]))
+		chunks = append(chunks, packet[12:])
+	}
+	assert.True(t, count > 1)
+
+	reader, err := zlib.NewReader(bytes.NewReader(bytes.Join(chunks, nil)))
+	assert.NoError(t, err)
+	data, _ := ioutil.ReadAll(reader)
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &m))
+	assert.Equal(t, message, m["short_message"])
+}
+
+func TestGELFAppender_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	var received = make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := ioutil.ReadAll(conn)
+		received <- data
+	}()
+
+	appender, err := NewGELFTCPAppender(listener.Addr().String())
+	assert.NoError(t, err)
+	event := appender.Transformer().Transform(LogRecord{LoggerName: "test", Level: Info, LogTime: time.Now(), Message: "first"})
+	assert.NoError(t, appender.Append(event))
+	event = appender.Transformer().Transform(LogRecord{LoggerName: "test", Level: Info, LogTime: time.Now(), Message: "second"})
+	assert.NoError(t, appender.Append(event))
+	assert.NoError(t, appender.Close())
+
+	data := <-received
+	messages := bytes.Split(bytes.TrimSuffix(data, []byte{0}), []byte{0})
+	assert.Equal(t, 2, len(messages))
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(messages[1], &m))
+	assert.Equal(t, "second", m["short_message"])
+}
@@ -0,0 +1,355 @@
+package vlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Hash chained log files consist of entries, each starts with a header line:
+//
+//	#<seq> <length> <hash>     a record, followed by length bytes of message
+//	#checkpoint <seq> <hash>   written at the end of file before rotating, the last record's seq and hash
+//	#continue <seq> <hash>     written at the start of file after rotating, the last record's seq and hash
+//
+// Record seq starts from 1, the hash is hex encoded HMAC-SHA256 (or SHA256 if no key) of
+// previous hash, seq as 8 bytes big endian, and the message. The previous hash of the first record is all zero.
+
+const (
+	chainCheckpoint = "checkpoint"
+	chainContinue   = "continue"
+)
+
+// hashChain keep the chain status of hash chained log file
+type hashChain struct {
+	key  []byte
+	mac  hash.Hash
+	seq  int64
+	hash [sha256.Size]byte
+}
+
+func newHashChain(key []byte) *hashChain {
+	c := &hashChain{key: key}
+	if len(key) > 0 {
+		c.mac = hmac.New(sha256.New, key)
+	} else {
+		c.mac = sha256.New()
+	}
+	return c
+}
+
+// compute the hash of record
+func (c *hashChain) sum(prev [sha256.Size]byte, seq int64, message []byte) [sha256.Size]byte {
+	var seqBytes [8]byte
+	binary.BigEndian.PutUint64(seqBytes[:], uint64(seq))
+	c.mac.Reset()
+	c.mac.Write(prev[:])
+	c.mac.Write(seqBytes[:])
+	c.mac.Write(message)
+	var sum [sha256.Size]byte
+	c.mac.Sum(sum[:0])
+	return sum
+}
+
+// append the record entry for message to buf, and advance the chain
+func (c *hashChain) appendRecord(buf []byte, message []byte) []byte {
+	c.seq++
+	c.hash = c.sum(c.hash, c.seq, message)
+	buf = append(buf, '#')
+	buf = strconv.AppendInt(buf, c.seq, 10)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(len(message)), 10)
+	buf = append(buf, ' ')
+	buf = appendHex(buf, c.hash[:])
+	buf = append(buf, '\n')
+	return append(buf, message...)
+}
+
+// append checkpoint or continue entry, with current chain status
+func (c *hashChain) appendMark(buf []byte, kind string) []byte {
+	buf = append(buf, '#')
+	buf = append(buf, kind...)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, c.seq, 10)
+	buf = append(buf, ' ')
+	buf = appendHex(buf, c.hash[:])
+	return append(buf, '\n')
+}
+
+func appendHex(buf []byte, data []byte) []byte {
+	const digits = "0123456789abcdef"
+	for _, b := range data {
+		buf = append(buf, digits[b>>4], digits[b&0xf])
+	}
+	return buf
+}
+
+// chainEntry is one entry parsed from hash chained log file
+type chainEntry struct {
+	kind    string // empty for record
+	seq     int64
+	hash    [sha256.Size]byte
+	message []byte
+	offset  int64
+}
+
+// chainReader parse entries from hash chained log file
+type chainReader struct {
+	reader *bufio.Reader
+	offset int64
+}
+
+func newChainReader(r io.Reader) *chainReader {
+	return &chainReader{reader: bufio.NewReader(r)}
+}
+
+// read next entry, return io.EOF if no more entries
+func (r *chainReader) next() (*chainEntry, error) {
+	entry := &chainEntry{offset: r.offset}
+	line, err := r.reader.ReadBytes('\n')
+	r.offset += int64(len(line))
+	if err == io.EOF && len(line) == 0 {
+		return nil, io.EOF
+	}
+	if err == io.EOF {
+		return nil, errors.New("truncated entry header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	parts := bytes.Split(line[:len(line)-1], []byte{' '})
+	if len(parts) != 3 || len(parts[0]) < 2 || parts[0][0] != '#' {
+		return nil, errors.New("invalid entry header")
+	}
+	first := string(parts[0][1:])
+	var hashPart []byte
+	switch first {
+	case chainCheckpoint, chainContinue:
+		entry.kind = first
+		if entry.seq, err = strconv.ParseInt(string(parts[1]), 10, 64); err != nil {
+			return nil, errors.New("invalid entry seq")
+		}
+		hashPart = parts[2]
+	default:
+		if entry.seq, err = strconv.ParseInt(first, 10, 64); err != nil {
+			return nil, errors.New("invalid entry seq")
+		}
+		length, err := strconv.Atoi(string(parts[1]))
+		if err != nil || length < 0 {
+			return nil, errors.New("invalid record length")
+		}
+		entry.message = make([]byte, length)
+		n, err := io.ReadFull(r.reader, entry.message)
+		r.offset += int64(n)
+		if err != nil {
+			return nil, errors.New("truncated record")
+		}
+		hashPart = parts[2]
+	}
+	if hex.DecodedLen(len(hashPart)) != sha256.Size {
+		return nil, errors.New("invalid entry hash")
+	}
+	if _, err = hex.Decode(entry.hash[:], hashPart); err != nil {
+		return nil, errors.New("invalid entry hash")
+	}
+	return entry, nil
+}
+
+// read the last chain status of file, keys is not nil if file is encrypted. ok is false if there is no entry in file.
+func lastChainStatus(path string, keys KeyProvider) (seq int64, sum [sha256.Size]byte, ok bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, sum, false, err
+	}
+	defer file.Close()
+	reader := newChainReader(chainSource(file, keys))
+	for {
+		entry, err := reader.next()
+		// the file of appender not closed properly has no final chunk, the chain can still continue
+		if err == io.EOF || err == ErrEncryptedLogTruncated {
+			return seq, sum, ok, nil
+		}
+		if err != nil {
+			return 0, sum, false, fmt.Errorf("%s:%d: %v", path, reader.offset, err)
+		}
+		seq, sum, ok = entry.seq, entry.hash, true
+	}
+}
+
+// ChainError is returned by VerifyHashChain, describing the first broken or missing record
+type ChainError struct {
+	File   string // the log file path
+	Offset int64  // the offset of broken entry in file
+	Seq    int64  // the seq of expected record
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("%s:%d: record %d: %s", e.File, e.Offset, e.Seq, e.Reason)
+}
+
+// VerifyHashChain verify the hash chained log files written by FileAppender with SetHashChain, including the
+// rotated files. key should be the same as passed to SetHashChain.
+// Return the number of verified records, and a *ChainError for the first broken or missing record.
+// The rotated files before the oldest existing one are treated as removed, not as missing.
+// The chain can not tell the newest records are removed, or the current file is truncated at an entry boundary, as
+// the remaining records are still chained; to detect this, compare the returned number of records with the count kept
+// elsewhere, such as in remote log storage.
+func VerifyHashChain(path string, key []byte) (int64, error) {
+	return VerifyEncryptedHashChain(path, key, nil)
+}
+
+// VerifyEncryptedHashChain verify the hash chained log files written by FileAppender with both SetEncryption and
+// SetHashChain, keys should provide all keys used by the log files. If keys is nil, files are not decrypted, as
+// VerifyHashChain. Offsets in ChainError are of decrypted data.
+// The rotated files should have final chunks of encryption segments, while the current log file may be still
+// being written.
+func VerifyEncryptedHashChain(path string, key []byte, keys KeyProvider) (int64, error) {
+	files, err := chainFiles(path, keys)
+	if err != nil {
+		return 0, err
+	}
+	chain := newHashChain(key)
+	var records int64
+	for idx, file := range files {
+		n, err := verifyChainFile(file.path, keys, chain, idx == 0, file.path == path)
+		records += n
+		if err != nil {
+			return records, err
+		}
+	}
+	return records, nil
+}
+
+type chainFile struct {
+	path     string
+	startSeq int64
+}
+
+// the log file and rotated files, ordered by the seq of their first records. Empty files are ignored.
+func chainFiles(path string, keys KeyProvider) ([]chainFile, error) {
+	ext := filepath.Ext(path)
+	base := path[:len(path)-len(ext)]
+	paths := []string{path}
+	for _, suffix := range getLogSuffixed(path) {
+		paths = append(paths, base+"."+suffix+ext)
+	}
+
+	var files []chainFile
+	for _, p := range paths {
+		file, err := os.Open(p)
+		if err != nil {
+			if os.IsNotExist(err) && p == path {
+				continue
+			}
+			return nil, err
+		}
+		entry, err := newChainReader(chainSource(file, keys)).next()
+		file.Close()
+		if err == io.EOF || err == ErrEncryptedLogTruncated {
+			continue
+		}
+		if err != nil {
+			return nil, &ChainError{File: p, Reason: err.Error()}
+		}
+		startSeq := entry.seq
+		if entry.kind == chainContinue {
+			startSeq++
+		}
+		files = append(files, chainFile{path: p, startSeq: startSeq})
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].startSeq < files[j].startSeq
+	})
+	return files, nil
+}
+
+// the reader of chain entries, decrypt file if keys is not nil
+func chainSource(file io.Reader, keys KeyProvider) io.Reader {
+	if keys == nil {
+		return file
+	}
+	return NewDecryptReader(file, keys)
+}
+
+// verify one file, continue the chain status. Return the number of verified records.
+// current is true if the file is the log file being written, which may has no final chunk if encrypted.
+func verifyChainFile(path string, keys KeyProvider, chain *hashChain, first bool, current bool) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := newChainReader(chainSource(file, keys))
+	var records int64
+	checkpointed := false
+	for idx := 0; ; idx++ {
+		entry, err := reader.next()
+		if err == io.EOF || (err == ErrEncryptedLogTruncated && current) {
+			return records, nil
+		}
+		chainErr := &ChainError{File: path, Offset: reader.offset, Seq: chain.seq + 1}
+		if err != nil {
+			chainErr.Reason = err.Error()
+			return records, chainErr
+		}
+		chainErr.Offset = entry.offset
+		if checkpointed {
+			chainErr.Reason = "entry after checkpoint"
+			return records, chainErr
+		}
+		switch entry.kind {
+		case chainContinue:
+			if idx != 0 {
+				chainErr.Reason = "continue entry not at file start"
+				return records, chainErr
+			}
+			if first {
+				// the previous files are removed
+				chain.seq, chain.hash = entry.seq, entry.hash
+				continue
+			}
+			if entry.seq > chain.seq {
+				chainErr.Reason = fmt.Sprintf("records %d-%d are missing", chain.seq+1, entry.seq)
+				return records, chainErr
+			}
+			if entry.seq != chain.seq || entry.hash != chain.hash {
+				chainErr.Reason = "continue entry does not match previous file"
+				return records, chainErr
+			}
+		case chainCheckpoint:
+			if entry.seq != chain.seq || entry.hash != chain.hash {
+				chainErr.Reason = "checkpoint does not match records"
+				return records, chainErr
+			}
+			checkpointed = true
+		default:
+			if entry.seq > chain.seq+1 {
+				chainErr.Reason = fmt.Sprintf("records %d-%d are missing", chain.seq+1, entry.seq-1)
+				return records, chainErr
+			}
+			if entry.seq <= chain.seq {
+				chainErr.Reason = fmt.Sprintf("unexpected record %d", entry.seq)
+				return records, chainErr
+			}
+			if chain.sum(chain.hash, entry.seq, entry.message) != entry.hash {
+				chainErr.Reason = "hash mismatch, record is modified"
+				return records, chainErr
+			}
+			chain.seq++
+			chain.hash = entry.hash
+			records++
+		}
+	}
+}
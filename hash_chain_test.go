@@ -0,0 +1,87 @@
+package vlog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeChainedLogs(t *testing.T, path string, key []byte, from int, to int) {
+	appender, err := NewFileAppender(path, NewSizeRotater(100, 3))
+	assert.NoError(t, err)
+	assert.NoError(t, appender.SetHashChain(key))
+	for i := from; i < to; i++ {
+		assert.NoError(t, appender.Append(AppendEvent{Level: Info, Message: []byte("record " + strconv.Itoa(i) + "\n")}))
+	}
+	assert.NoError(t, appender.Close())
+}
+
+func TestHashChain(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	key := []byte("secret")
+
+	writeChainedLogs(t, path, key, 0, 30)
+	// restart appender, continue the chain
+	writeChainedLogs(t, path, key, 30, 35)
+	records, err := VerifyHashChain(path, key)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(35), records)
+
+	rotated := filepath.Join(dir, "audit.001.log")
+	content := readFile(t, rotated)
+	assert.True(t, strings.HasPrefix(content, "#1 9 "), content)
+	assert.Contains(t, content, "\nrecord 0\n#2 9 ")
+	assert.Contains(t, content, "\n#checkpoint ")
+	assert.True(t, strings.HasPrefix(readFile(t, filepath.Join(dir, "audit.002.log")), "#continue "))
+
+	_, err = VerifyHashChain(path, []byte("wrong key"))
+	assert.Error(t, err)
+
+	// oldest files removed
+	assert.NoError(t, os.Remove(rotated))
+	records, err = VerifyHashChain(path, key)
+	assert.NoError(t, err)
+	assert.True(t, records < 35)
+}
+
+func TestHashChain_Tampered(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	writeChainedLogs(t, path, nil, 0, 30)
+
+	rotated := filepath.Join(dir, "audit.002.log")
+	content := readFile(t, rotated)
+	// modify a record
+	modified := strings.Replace(content, "record ", "recorx ", 1)
+	assert.NoError(t, ioutil.WriteFile(rotated, []byte(modified), 0644))
+	_, err := VerifyHashChain(path, nil)
+	chainErr, ok := err.(*ChainError)
+	if assert.True(t, ok, "%v", err) {
+		assert.Equal(t, rotated, chainErr.File)
+		assert.Contains(t, chainErr.Reason, "hash mismatch")
+	}
+
+	// remove a record
+	lines := strings.SplitAfter(content, "\n")
+	removed := strings.Join(append(lines[:1:1], lines[3:]...), "")
+	assert.NoError(t, ioutil.WriteFile(rotated, []byte(removed), 0644))
+	_, err = VerifyHashChain(path, nil)
+	chainErr, ok = err.(*ChainError)
+	if assert.True(t, ok, "%v", err) {
+		assert.Contains(t, chainErr.Reason, "missing")
+	}
+
+	// remove a middle file
+	assert.NoError(t, os.Remove(rotated))
+	_, err = VerifyHashChain(path, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "missing")
+}
@@ -0,0 +1,359 @@
+package vlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// default batch settings for HTTPAppender
+const (
+	DefaultHTTPBatchCount   = 1000
+	DefaultHTTPBatchBytes   = 1024 * 1024
+	DefaultHTTPBatchLatency = time.Second
+)
+
+const spoolFileSuffix = ".spool"
+
+var _ Appender = (*HTTPAppender)(nil)
+var _ Flusher = (*HTTPAppender)(nil)
+
+// HTTPAppender send log to a http ingestion endpoint in batches.
+// Events are collected and sent by POST request when batch count or bytes reach the limit, or the first event in
+// batch has waited for max latency. The request body is encoded by the HTTPEncoder.
+//
+// Request failed with network error, 429 or 5xx status are retried with exponential backoff. If still failed and
+// spool dir is set, the request body is saved to spool dir, and re-sent after next success request, or when there is
+// no batch to send for max latency. The delay asked by Retry-After header is capped by the backoff of the last retry.
+// Append never waits for sending: when too many batches are waiting, new batches are spooled if spool dir is set,
+// otherwise dropped, and counted by Dropped.
+//
+// The transformer of HTTPAppender is a JSONTransformer without caller by default.
+// Close should be called before program exit, to send the pending events.
+type HTTPAppender struct {
+	*CanFormattedMixin
+	url          string
+	encoder      HTTPEncoder
+	client       *http.Client
+	header       http.Header
+	gzip         bool
+	maxRetries   int
+	retryBackoff time.Duration
+	spoolDir     string
+	spoolBytes   int64
+	spoolSeq     int64
+	batcher      *batcher
+}
+
+// NewHTTPAppender create http appender, which send log to url, encoding request body with encoder.
+func NewHTTPAppender(url string, encoder HTTPEncoder) *HTTPAppender {
+	appender := &HTTPAppender{
+		CanFormattedMixin: NewAppenderMixin(),
+		url:               url,
+		encoder:           encoder,
+		client:            &http.Client{Timeout: 30 * time.Second},
+		header:            http.Header{},
+		maxRetries:        3,
+		retryBackoff:      500 * time.Millisecond,
+	}
+	appender.SetTransformer(NewJSONTransformer(false))
+	appender.batcher = newBatcher(DefaultHTTPBatchCount, DefaultHTTPBatchBytes, DefaultHTTPBatchLatency, appender.send,
+		appender.overflow, appender.resendSpooled)
+	return appender
+}
+
+// SetBatch set the max count, total message bytes and latency of one batch.
+// zero or negative value means no limit for this dimension.
+func (h *HTTPAppender) SetBatch(maxCount int, maxBytes int, maxLatency time.Duration) {
+	h.batcher.setLimits(maxCount, maxBytes, maxLatency)
+}
+
+// SetClient set the http client used to send request.
+// This method should be called before appender start to work.
+func (h *HTTPAppender) SetClient(client *http.Client) {
+	h.client = client
+}
+
+// SetHeader set a custom request header, such as Authorization.
+// This method should be called before appender start to work.
+func (h *HTTPAppender) SetHeader(key string, value string) {
+	h.header.Set(key, value)
+}
+
+// SetGzip set if compress request body with gzip.
+// This method should be called before appender start to work.
+func (h *HTTPAppender) SetGzip(gzip bool) {
+	h.gzip = gzip
+}
+
+// SetRetry set the max retry times and the backoff of first retry, the backoff doubles for every following retry.
+// This method should be called before appender start to work.
+func (h *HTTPAppender) SetRetry(maxRetries int, backoff time.Duration) {
+	h.maxRetries = maxRetries
+	h.retryBackoff = backoff
+}
+
+// SetSpool set the dir to save request bodies failed to send, and the max total size of spooled files,
+// the oldest files are removed when exceed the size. maxBytes <= 0 means no limit.
+// This method should be called before appender start to work.
+func (h *HTTPAppender) SetSpool(dir string, maxBytes int64) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return wrapError("create spool dir failed", err)
+	}
+	h.spoolDir = dir
+	h.spoolBytes = maxBytes
+	return nil
+}
+
+// Append add event to batch
+func (h *HTTPAppender) Append(event AppendEvent) error {
+	return h.batcher.add(event)
+}
+
+// Flush send pending events, and wait until the request finished
+func (h *HTTPAppender) Flush() error {
+	h.batcher.flush()
+	return nil
+}
+
+// Close send pending events and stop the appender
+func (h *HTTPAppender) Close() error {
+	h.batcher.close()
+	return nil
+}
+
+// Dropped return the count of events dropped, as too many batches are waiting to be sent and spool dir is not set
+func (h *HTTPAppender) Dropped() int64 {
+	return h.batcher.droppedCount()
+}
+
+// encode entries to request body
+func (h *HTTPAppender) encode(entries []batchEntry) ([]byte, error) {
+	var events = make([]AppendEvent, len(entries))
+	var times = make([]int64, len(entries))
+	for idx, entry := range entries {
+		events[idx] = entry.event
+		times[idx] = entry.time.UnixNano()
+	}
+	var buffer bytes.Buffer
+	if err := h.encoder.Encode(&buffer, events, times); err != nil {
+		return nil, wrapError("encode http log body error", err)
+	}
+	if !h.gzip {
+		return buffer.Bytes(), nil
+	}
+	body, err := gzipBytes(buffer.Bytes())
+	if err != nil {
+		return nil, wrapError("gzip http log body error", err)
+	}
+	return body, nil
+}
+
+// spool batches can not be queued for sending, return false if spool dir is not set or failed
+func (h *HTTPAppender) overflow(entries []batchEntry) bool {
+	if h.spoolDir == "" {
+		return false
+	}
+	body, err := h.encode(entries)
+	if err == nil {
+		err = h.spool(body)
+	}
+	if err != nil {
+		reportError("spool http log body error", err)
+		return false
+	}
+	return true
+}
+
+func (h *HTTPAppender) send(entries []batchEntry) {
+	body, err := h.encode(entries)
+	if err != nil {
+		reportError("send http log error", err)
+		return
+	}
+
+	retryable, err := h.postWithRetry(body)
+	if err == nil {
+		h.resendSpooled()
+		return
+	}
+	if retryable && h.spoolDir != "" {
+		if spoolErr := h.spool(body); spoolErr != nil {
+			reportError("spool http log body error", spoolErr)
+		}
+		return
+	}
+	reportError("send http log error", err)
+}
+
+// post body, retry if failed. return if the error is retryable.
+// Stop retrying when appender is closing, the body can be spooled then.
+func (h *HTTPAppender) postWithRetry(body []byte) (bool, error) {
+	backoff := h.retryBackoff
+	maxBackoff := h.maxBackoff()
+	for retry := 0; ; retry++ {
+		retryable, retryAfter, err := h.post(body)
+		if err == nil || !retryable || retry >= h.maxRetries {
+			return retryable, err
+		}
+		if retryAfter <= 0 {
+			retryAfter = backoff
+			backoff *= 2
+		}
+		if retryAfter > maxBackoff {
+			retryAfter = maxBackoff
+		}
+		if !h.batcher.sleep(retryAfter) {
+			return retryable, err
+		}
+	}
+}
+
+// the backoff of the last retry
+func (h *HTTPAppender) maxBackoff() time.Duration {
+	backoff := h.retryBackoff
+	for i := 1; i < h.maxRetries && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+	return backoff
+}
+
+// post body once. return if the error is retryable, and the retry delay the server asked
+func (h *HTTPAppender) post(body []byte) (bool, time.Duration, error) {
+	request, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	for key, values := range h.header {
+		request.Header[key] = values
+	}
+	request.Header.Set("Content-Type", h.encoder.ContentType())
+	if h.gzip {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return true, 0, err
+	}
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	_ = response.Body.Close()
+	if response.StatusCode < 300 {
+		return false, 0, nil
+	}
+
+	err = errors.New("http log endpoint response status: " + response.Status)
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return true, retryAfter, err
+	}
+	return false, 0, err
+}
+
+func (h *HTTPAppender) spool(body []byte) error {
+	seq := atomic.AddInt64(&h.spoolSeq, 1)
+	// file names sort by time
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + strconv.FormatInt(seq, 10) + spoolFileSuffix
+	// spool may be called by appending goroutines, write to temp file first to not resend partial file
+	path := filepath.Join(h.spoolDir, name)
+	if err := ioutil.WriteFile(path+".tmp", body, 0666); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	if h.spoolBytes <= 0 {
+		return nil
+	}
+
+	files := h.spooledFiles()
+	var total int64
+	for _, file := range files {
+		total += file.Size()
+	}
+	for _, file := range files {
+		if total <= h.spoolBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(h.spoolDir, file.Name())); err == nil {
+			total -= file.Size()
+		}
+	}
+	return nil
+}
+
+// spooled files, the oldest first
+func (h *HTTPAppender) spooledFiles() []os.FileInfo {
+	infos, _ := ioutil.ReadDir(h.spoolDir)
+	var files []os.FileInfo
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), spoolFileSuffix) {
+			files = append(files, info)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		ti, si := spoolFileOrder(files[i].Name())
+		tj, sj := spoolFileOrder(files[j].Name())
+		return ti < tj || ti == tj && si < sj
+	})
+	return files
+}
+
+// the time and sequence in spool file name
+func spoolFileOrder(name string) (int64, int64) {
+	name = strings.TrimSuffix(name, spoolFileSuffix)
+	idx := strings.IndexByte(name, '-')
+	if idx < 0 {
+		return 0, 0
+	}
+	ts, _ := strconv.ParseInt(name[:idx], 10, 64)
+	seq, _ := strconv.ParseInt(name[idx+1:], 10, 64)
+	return ts, seq
+}
+
+// re-send spooled bodies, stop when failed
+func (h *HTTPAppender) resendSpooled() {
+	if h.spoolDir == "" {
+		return
+	}
+	for _, file := range h.spooledFiles() {
+		path := filepath.Join(h.spoolDir, file.Name())
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		retryable, _, err := h.post(body)
+		if err != nil && retryable {
+			return
+		}
+		if err != nil {
+			reportError("send spooled http log error", err)
+		}
+		_ = os.Remove(path)
+	}
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
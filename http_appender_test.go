@@ -0,0 +1,288 @@
+package vlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type httpRecorder struct {
+	lock     sync.Mutex
+	bodies   []string
+	requests []*http.Request
+	statuses []int // statuses to response in order, 200 after used up
+}
+
+func (r *httpRecorder) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var reader = request.Body
+	if request.Header.Get("Content-Encoding") == "gzip" {
+		reader, _ = gzip.NewReader(request.Body)
+	}
+	body, _ := ioutil.ReadAll(reader)
+	var status = http.StatusOK
+	if len(r.statuses) > 0 {
+		status = r.statuses[0]
+		r.statuses = r.statuses[1:]
+	}
+	if status == http.StatusOK {
+		r.bodies = append(r.bodies, string(body))
+		r.requests = append(r.requests, request)
+	}
+	w.WriteHeader(status)
+}
+
+func (r *httpRecorder) received() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+func appendMessages(appender Appender, messages ...string) {
+	for _, message := range messages {
+		_ = appender.Append(AppendEvent{LoggerName: "test", Level: Info, Message: []byte(message + "\n")})
+	}
+}
+
+func TestHTTPAppender_BatchByCount(t *testing.T) {
+	recorder := &httpRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	appender := NewHTTPAppender(server.URL, NewNDJSONEncoder())
+	appender.SetBatch(2, 0, time.Hour)
+	appender.SetGzip(true)
+	appender.SetHeader("Authorization", "Bearer token")
+	appendMessages(appender, `{"a":1}`, `{"a":2}`, `{"a":3}`)
+	assert.NoError(t, appender.Close())
+
+	assert.Equal(t, []string{"{\"a\":1}\n{\"a\":2}\n", "{\"a\":3}\n"}, recorder.received())
+	assert.Equal(t, "Bearer token", recorder.requests[0].Header.Get("Authorization"))
+	assert.Equal(t, "application/x-ndjson", recorder.requests[0].Header.Get("Content-Type"))
+	assert.Equal(t, errBatcherClosed, appender.Append(AppendEvent{Message: []byte("{}")}))
+}
+
+func TestHTTPAppender_BatchByLatency(t *testing.T) {
+	recorder := &httpRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	appender := NewHTTPAppender(server.URL, NewJSONArrayEncoder())
+	defer appender.Close()
+	appender.SetBatch(100, 0, 20*time.Millisecond)
+	logger := GetLogger("http_appender_test")
+	logger.SetAppenders(appender)
+	logger.Info("first", F("k", "v"))
+	logger.Info("second")
+
+	var received []string
+	for i := 0; i < 100 && len(received) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		received = recorder.received()
+	}
+	assert.Equal(t, 1, len(received))
+	var records []map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(received[0]), &records))
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, "first", records[0]["message"])
+	assert.Equal(t, "v", records[0]["k"])
+	assert.Equal(t, "http_appender_test", records[1]["logger"])
+}
+
+func TestHTTPAppender_Retry(t *testing.T) {
+	recorder := &httpRecorder{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	appender := NewHTTPAppender(server.URL, NewNDJSONEncoder())
+	appender.SetRetry(2, time.Millisecond)
+	appendMessages(appender, `{"a":1}`)
+	assert.NoError(t, appender.Flush())
+	assert.Equal(t, []string{"{\"a\":1}\n"}, recorder.received())
+	assert.NoError(t, appender.Close())
+}
+
+func TestHTTPAppender_RetryAfter(t *testing.T) {
+	var lock sync.Mutex
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		lock.Unlock()
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	appender := NewHTTPAppender(server.URL, NewNDJSONEncoder())
+	appender.SetRetry(2, 10*time.Millisecond)
+	appendMessages(appender, `{"a":1}`)
+	start := time.Now()
+	assert.NoError(t, appender.Flush())
+	// capped by the backoff of the last retry, 10ms + 20ms
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Equal(t, 3, requests)
+
+	// close stop waiting
+	appender.SetRetry(1, time.Hour)
+	appendMessages(appender, `{"a":2}`)
+	go appender.Flush()
+	for i := 0; i < 100; i++ {
+		lock.Lock()
+		sent := requests
+		lock.Unlock()
+		if sent == 4 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	start = time.Now()
+	assert.NoError(t, appender.Close())
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func tempSpoolDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "vlog-spool")
+	assert.NoError(t, err)
+	return dir
+}
+
+func TestHTTPAppender_Spool(t *testing.T) {
+	dir := tempSpoolDir(t)
+	defer os.RemoveAll(dir)
+	recorder := &httpRecorder{statuses: []int{500, 500}}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	appender := NewHTTPAppender(server.URL, NewNDJSONEncoder())
+	defer appender.Close()
+	appender.SetRetry(1, time.Millisecond)
+	assert.NoError(t, appender.SetSpool(dir, 0))
+
+	appendMessages(appender, `{"a":1}`)
+	assert.NoError(t, appender.Flush())
+	assert.Equal(t, 0, len(recorder.received()))
+	assert.Equal(t, 1, len(appender.spooledFiles()))
+
+	appendMessages(appender, `{"a":2}`)
+	assert.NoError(t, appender.Flush())
+	assert.Equal(t, []string{"{\"a\":2}\n", "{\"a\":1}\n"}, recorder.received())
+	assert.Equal(t, 0, len(appender.spooledFiles()))
+}
+
+func TestHTTPAppender_SpoolRetryByTimer(t *testing.T) {
+	dir := tempSpoolDir(t)
+	defer os.RemoveAll(dir)
+	recorder := &httpRecorder{statuses: []int{500, 500}}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	appender := NewHTTPAppender(server.URL, NewNDJSONEncoder())
+	defer appender.Close()
+	appender.SetRetry(1, time.Millisecond)
+	appender.SetBatch(100, 0, 10*time.Millisecond)
+	assert.NoError(t, appender.SetSpool(dir, 0))
+	appendMessages(appender, `{"a":1}`)
+	assert.NoError(t, appender.Flush())
+	assert.Equal(t, 0, len(recorder.received()))
+
+	// resent without new events
+	var received []string
+	for i := 0; i < 100 && len(received) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		received = recorder.received()
+	}
+	assert.Equal(t, []string{"{\"a\":1}\n"}, received)
+}
+
+func TestHTTPAppender_SpooledFilesOrder(t *testing.T) {
+	dir := tempSpoolDir(t)
+	defer os.RemoveAll(dir)
+	appender := NewHTTPAppender("http://127.0.0.1:0", NewNDJSONEncoder())
+	defer appender.Close()
+	assert.NoError(t, appender.SetSpool(dir, 0))
+	for _, name := range []string{"100-10", "100-9", "99-11", "100-2"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+spoolFileSuffix), nil, 0666))
+	}
+	var names []string
+	for _, file := range appender.spooledFiles() {
+		names = append(names, file.Name())
+	}
+	assert.Equal(t, []string{"99-11.spool", "100-2.spool", "100-9.spool", "100-10.spool"}, names)
+}
+
+func TestLokiEncoder_Encode(t *testing.T) {
+	encoder := NewLokiEncoder(map[string]string{"app": "vlog"})
+	var buffer bytes.Buffer
+	events := []AppendEvent{
+		{LoggerName: "l1", Level: Info, Message: []byte("m1\n")},
+		{LoggerName: "l2", Level: Warn, Message: []byte("m2\n")},
+		{LoggerName: "l1", Level: Info, Message: []byte("m3\n")},
+	}
+	assert.NoError(t, encoder.Encode(&buffer, events, []int64{1, 2, 3}))
+	assert.Equal(t, `{"streams":[`+
+		`{"stream":{"app":"vlog","level":"info","logger":"l1"},"values":[["1","m1"],["3","m3"]]},`+
+		`{"stream":{"app":"vlog","level":"warn","logger":"l2"},"values":[["2","m2"]]}]}`, buffer.String())
+}
+
+func TestElasticsearchBulkEncoder_Encode(t *testing.T) {
+	var buffer bytes.Buffer
+	events := []AppendEvent{{Message: []byte("{\"a\":1}\n")}, {Message: []byte("{\"a\":2}\n")}}
+	assert.NoError(t, NewElasticsearchBulkEncoder("logs").Encode(&buffer, events, []int64{1, 2}))
+	lines := strings.Split(buffer.String(), "\n")
+	assert.Equal(t, []string{`{"index":{"_index":"logs"}}`, `{"a":1}`, `{"index":{"_index":"logs"}}`, `{"a":2}`, ""}, lines)
+}
+
+// blockingHandler block requests until released
+type blockingHandler struct {
+	release chan struct{}
+}
+
+func (h *blockingHandler) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	<-h.release
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestHTTPAppender_QueueFull(t *testing.T) {
+	dir := tempSpoolDir(t)
+	defer os.RemoveAll(dir)
+	handler := &blockingHandler{release: make(chan struct{})}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	appender := NewHTTPAppender(server.URL, NewNDJSONEncoder())
+	appender.SetBatch(1, 0, time.Hour)
+	count := batchQueueSize * 3
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		appendMessages(appender, `{"a":1}`)
+	}
+	assert.True(t, time.Since(start) < 5*time.Second)
+	dropped := appender.Dropped()
+	assert.True(t, dropped >= int64(count-batchQueueSize-1))
+
+	spooled := NewHTTPAppender(server.URL, NewNDJSONEncoder())
+	spooled.SetBatch(1, 0, time.Hour)
+	assert.NoError(t, spooled.SetSpool(dir, 0))
+	for i := 0; i < count; i++ {
+		appendMessages(spooled, `{"a":1}`)
+	}
+	assert.Equal(t, int64(0), spooled.Dropped())
+	assert.True(t, len(spooled.spooledFiles()) >= count-batchQueueSize-2)
+
+	close(handler.release)
+	assert.NoError(t, appender.Close())
+	assert.NoError(t, spooled.Close())
+}
@@ -0,0 +1,194 @@
+package vlog
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HTTPEncoder encode a batch of log events to http request body, for HTTPAppender.
+// The log event messages are transformed by the appender's transformer, encoders expect one json object per event,
+// as JSONTransformer produces, unless noted otherwise.
+type HTTPEncoder interface {
+	// ContentType return the content type of encoded body
+	ContentType() string
+	// Encode write the body for the events to buffer. times are the time the events were appended.
+	Encode(buffer *bytes.Buffer, events []AppendEvent, times []int64) error
+}
+
+// trim the line break at the end of message
+func trimMessage(message []byte) []byte {
+	return bytes.TrimRight(message, "\r\n")
+}
+
+var _ HTTPEncoder = (*NDJSONEncoder)(nil)
+
+// NDJSONEncoder encode events as new line delimited json, one event per line.
+type NDJSONEncoder struct{}
+
+// NewNDJSONEncoder create ndjson encoder
+func NewNDJSONEncoder() *NDJSONEncoder {
+	return &NDJSONEncoder{}
+}
+
+// ContentType return application/x-ndjson
+func (NDJSONEncoder) ContentType() string {
+	return "application/x-ndjson"
+}
+
+// Encode write events line by line
+func (NDJSONEncoder) Encode(buffer *bytes.Buffer, events []AppendEvent, times []int64) error {
+	for _, event := range events {
+		buffer.Write(trimMessage(event.Message))
+		buffer.WriteByte('\n')
+	}
+	return nil
+}
+
+var _ HTTPEncoder = (*JSONArrayEncoder)(nil)
+
+// JSONArrayEncoder encode events as a json array.
+type JSONArrayEncoder struct{}
+
+// NewJSONArrayEncoder create json array encoder
+func NewJSONArrayEncoder() *JSONArrayEncoder {
+	return &JSONArrayEncoder{}
+}
+
+// ContentType return application/json
+func (JSONArrayEncoder) ContentType() string {
+	return "application/json"
+}
+
+// Encode write events as elements of json array
+func (JSONArrayEncoder) Encode(buffer *bytes.Buffer, events []AppendEvent, times []int64) error {
+	buffer.WriteByte('[')
+	for idx, event := range events {
+		if idx > 0 {
+			buffer.WriteByte(',')
+		}
+		buffer.Write(trimMessage(event.Message))
+	}
+	buffer.WriteByte(']')
+	return nil
+}
+
+var _ HTTPEncoder = (*LokiEncoder)(nil)
+
+// LokiEncoder encode events as Grafana Loki push api body, for url like http://loki:3100/loki/api/v1/push.
+// Events are grouped into streams by labels: logger, level, and the static labels.
+// The event message is sent as log line as is, it need not to be json.
+type LokiEncoder struct {
+	labels map[string]string
+}
+
+// NewLokiEncoder create loki encoder, labels are static labels added to all streams, such as app or env.
+func NewLokiEncoder(labels map[string]string) *LokiEncoder {
+	var copied = make(map[string]string, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+	return &LokiEncoder{labels: copied}
+}
+
+// ContentType return application/json
+func (LokiEncoder) ContentType() string {
+	return "application/json"
+}
+
+// Encode write loki push request json
+func (e *LokiEncoder) Encode(buffer *bytes.Buffer, events []AppendEvent, times []int64) error {
+	type streamKey struct {
+		logger string
+		level  Level
+	}
+	var keys []streamKey
+	var streams = map[streamKey][]int{}
+	for idx, event := range events {
+		key := streamKey{logger: event.LoggerName, level: event.Level}
+		if _, ok := streams[key]; !ok {
+			keys = append(keys, key)
+		}
+		streams[key] = append(streams[key], idx)
+	}
+
+	buffer.WriteString(`{"streams":[`)
+	for keyIdx, key := range keys {
+		if keyIdx > 0 {
+			buffer.WriteByte(',')
+		}
+		var labels = make(map[string]string, len(e.labels)+2)
+		for name, value := range e.labels {
+			labels[name] = value
+		}
+		labels["logger"] = key.logger
+		labels["level"] = strings.ToLower(key.level.Name())
+		var names = make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		buffer.WriteString(`{"stream":{`)
+		for idx, name := range names {
+			if idx > 0 {
+				buffer.WriteByte(',')
+			}
+			writeJSONString(buffer, name)
+			buffer.WriteByte(':')
+			writeJSONString(buffer, labels[name])
+		}
+		buffer.WriteString(`},"values":[`)
+		for idx, eventIdx := range streams[key] {
+			if idx > 0 {
+				buffer.WriteByte(',')
+			}
+			buffer.WriteString(`["`)
+			buffer.WriteString(strconv.FormatInt(times[eventIdx], 10))
+			buffer.WriteString(`",`)
+			writeJSONString(buffer, string(trimMessage(events[eventIdx].Message)))
+			buffer.WriteByte(']')
+		}
+		buffer.WriteString(`]}`)
+	}
+	buffer.WriteString(`]}`)
+	return nil
+}
+
+var _ HTTPEncoder = (*ElasticsearchBulkEncoder)(nil)
+
+// ElasticsearchBulkEncoder encode events as Elasticsearch _bulk api body, for url like http://es:9200/_bulk.
+type ElasticsearchBulkEncoder struct {
+	action string
+}
+
+// NewElasticsearchBulkEncoder create elasticsearch bulk encoder, index events into index.
+// If index is empty, the index should be specified in url, like http://es:9200/my-index/_bulk.
+func NewElasticsearchBulkEncoder(index string) *ElasticsearchBulkEncoder {
+	var buffer bytes.Buffer
+	if index == "" {
+		buffer.WriteString(`{"index":{}}`)
+	} else {
+		buffer.WriteString(`{"index":{"_index":`)
+		writeJSONString(&buffer, index)
+		buffer.WriteString(`}}`)
+	}
+	return &ElasticsearchBulkEncoder{action: buffer.String()}
+}
+
+// ContentType return application/x-ndjson
+func (ElasticsearchBulkEncoder) ContentType() string {
+	return "application/x-ndjson"
+}
+
+// Encode write action and document lines for every event
+func (e *ElasticsearchBulkEncoder) Encode(buffer *bytes.Buffer, events []AppendEvent, times []int64) error {
+	for _, event := range events {
+		buffer.WriteString(e.action)
+		buffer.WriteByte('\n')
+		buffer.Write(trimMessage(event.Message))
+		buffer.WriteByte('\n')
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package vlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+var _ AppendTransformer = (*JSONTransformer)(nil)
+
+// JSONTransformer transform log record to one line json, ended with a '\n'.
+// The json object contains keys: time, level, logger, message, and package/file/function/line if caller is enabled.
+// Fields are put into the json object with their keys, field keys conflict with the keys above are prefixed with "field.".
+// Errors passed by vlog.Err/vlog.ErrWithStack are output as json object, with keys message, type, causes and stack.
+type JSONTransformer struct {
+	withCaller bool
+}
+
+var jsonReservedKeys = map[string]bool{
+	"time":     true,
+	"level":    true,
+	"logger":   true,
+	"message":  true,
+	"package":  true,
+	"file":     true,
+	"function": true,
+	"line":     true,
+}
+
+// NewJSONTransformer create json transformer. If withCaller is true, the caller package/file/function/line are included.
+func NewJSONTransformer(withCaller bool) *JSONTransformer {
+	return &JSONTransformer{withCaller: withCaller}
+}
+
+// Transform convert log record to json line
+func (t *JSONTransformer) Transform(record LogRecord) AppendEvent {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.b = t.format(buf.b, &record)
+	message := append([]byte(nil), buf.b...)
+	return AppendEvent{LoggerName: record.LoggerName, Level: record.Level, Message: message}
+}
+
+// AppendTransform append json line of log record to buf
+func (t *JSONTransformer) AppendTransform(buf []byte, record LogRecord) []byte {
+	return t.format(buf, &record)
+}
+
+// format log record as json line and append to buf. This method should be called directly by
+// Transform/AppendTransform, for getting the right caller.
+func (t *JSONTransformer) format(buf []byte, record *LogRecord) []byte {
+	buf = append(buf, `{"time":"`...)
+	buf = appendTime(buf, record.LogTime, time.RFC3339Nano, nil)
+	buf = append(buf, `","level":`...)
+	buf = appendJSONString(buf, record.Level.Name())
+	buf = append(buf, `,"logger":`...)
+	buf = appendJSONString(buf, record.LoggerName)
+	buf = append(buf, `,"message":`...)
+	buf = appendJSONString(buf, record.Message)
+	if t.withCaller {
+		caller := getRecordCaller(record, transformCallerDepth+1+record.callerSkip)
+		buf = append(buf, `,"package":`...)
+		buf = appendJSONString(buf, caller.packageName)
+		buf = append(buf, `,"file":`...)
+		buf = appendJSONString(buf, caller.fileName)
+		buf = append(buf, `,"function":`...)
+		buf = appendJSONString(buf, caller.functionName)
+		buf = append(buf, `,"line":`...)
+		buf = strconv.AppendInt(buf, int64(caller.line), 10)
+	}
+	for _, field := range record.Fields {
+		buf = append(buf, ',')
+		if jsonReservedKeys[field.Key] {
+			buf = appendJSONString(buf, "field."+field.Key)
+		} else {
+			buf = appendJSONString(buf, field.Key)
+		}
+		buf = append(buf, ':')
+		if ev, ok := field.Value.(*errorValue); ok {
+			buf = appendJSONError(buf, ev)
+		} else {
+			buf = appendJSONValue(buf, field.Value)
+		}
+	}
+	return append(buf, "}\n"...)
+}
+
+func writeJSONString(buffer *bytes.Buffer, str string) {
+	var tmp [128]byte
+	buffer.Write(appendJSONString(tmp[:0], str))
+}
+
+const hexDigits = "0123456789abcdef"
+
+// append str as json string to buf, escaping as encoding/json do
+func appendJSONString(buf []byte, str string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for idx := 0; idx < len(str); {
+		if c := str[idx]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				idx++
+				continue
+			}
+			buf = append(buf, str[start:idx]...)
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				// control chars, and <, >, & for safely embedded in html
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			idx++
+			start = idx
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(str[idx:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, str[start:idx]...)
+			buf = append(buf, "\ufffd"...)
+			idx += size
+			start = idx
+			continue
+		}
+		// U+2028 and U+2029 are line separators in javascript
+		if r == '\u2028' || r == '\u2029' {
+			buf = append(buf, str[start:idx]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			idx += size
+			start = idx
+			continue
+		}
+		idx += size
+	}
+	buf = append(buf, str[start:]...)
+	return append(buf, '"')
+}
+
+// append field value as json to buf
+func appendJSONValue(buf []byte, value interface{}) []byte {
+	value = fieldValue(value)
+	switch v := value.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case string:
+		return appendJSONString(buf, v)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case uint64:
+		return strconv.AppendUint(buf, v, 10)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return appendJSONString(buf, err.Error())
+	}
+	return append(buf, data...)
+}
@@ -0,0 +1,54 @@
+package vlog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONTransformer_Transform(t *testing.T) {
+	transformer := NewJSONTransformer(true)
+	ts := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	event := transformer.Transform(LogRecord{
+		LoggerName: "test",
+		Level:      Info,
+		LogTime:    ts,
+		Message:    "a \"quoted\" message",
+		Fields:     []Field{F("count", 3), F("message", "conflict")},
+	})
+	assert.Equal(t, "test", event.LoggerName)
+	assert.Equal(t, Info, event.Level)
+	assert.True(t, strings.HasPrefix(string(event.Message),
+		`{"time":"2019-10-01T12:00:00Z","level":"Info","logger":"test","message":"a \"quoted\" message","package":`))
+	assert.True(t, strings.HasSuffix(string(event.Message), "}\n"))
+
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(event.Message, &m))
+	assert.Equal(t, float64(3), m["count"])
+	assert.Equal(t, "conflict", m["field.message"])
+}
+
+func TestJSONTransformer_Caller(t *testing.T) {
+	appender := NewBytesAppender()
+	appender.SetTransformer(NewJSONTransformer(true))
+	logger := GetLogger("json_transformer_test")
+	logger.SetAppenders(appender)
+	logger.Info("test")
+
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(appender.buffer.Bytes(), &m))
+	assert.Equal(t, "json_transformer_test.go", m["file"])
+	assert.Equal(t, "TestJSONTransformer_Caller", m["function"])
+	assert.Equal(t, "github.com/hsiafan/vlog", m["package"])
+}
+
+func TestAppendJSONString(t *testing.T) {
+	for _, str := range []string{"", "plain", "quote\" back\\slash", "line\nbreak\r\ttab", "\x00\x1f\x7f",
+		"<a href=\"x\">&</a>", "日本語", "invalid \xff utf8", "sep\u2028\u2029"} {
+		expected, _ := json.Marshal(str)
+		assert.Equal(t, string(expected), string(appendJSONString(nil, str)))
+	}
+}
@@ -0,0 +1,444 @@
+package vlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the regex matching ansi color codes output by {color:xxx} and {/color}
+const colorCodePattern = `(?:\x1b\[[0-9;]*m)?`
+
+// the regex matching fields output by {fields}, as key=value pairs delimited by white space, values may be quoted
+const fieldsPattern = `((?:[^\s=]+=(?:"(?:[^"\\]|\\.)*"|\S*))?(?: [^\s=]+=(?:"(?:[^"\\]|\\.)*"|\S*))*)`
+
+// PatternParser parse log text written by PatternTransformer back to LogRecords, with the same pattern.
+// Logger name, level, time, message and fields ({fields}, {field:key}, {error}, {stack}) are parsed,
+// the values of other variables are ignored. Values truncated by width filters can not be recovered.
+type PatternParser struct {
+	items     []patternItem
+	regex     *regexp.Regexp // match the whole record text
+	start     *regexp.Regexp // match the first line of record, nil if every line is a record
+	groupItem []int          // the item index of each capturing group
+}
+
+// NewPatternParser create parser for log text written by PatternTransformer with pattern
+func NewPatternParser(pattern string) (*PatternParser, error) {
+	transformer, err := NewPatternTransformer(pattern)
+	if err != nil {
+		return nil, err
+	}
+	p := &PatternParser{items: transformer.items}
+	var sb strings.Builder
+	var startExpr string
+	startFound := false
+	sb.WriteString(`^`)
+	for idx, item := range p.items {
+		switch item.kind {
+		case text:
+			if !startFound {
+				if nl := strings.IndexByte(item.str, '\n'); nl >= 0 {
+					// the first line of record ends here
+					startExpr = sb.String() + regexp.QuoteMeta(item.str[:nl])
+					startFound = true
+				}
+			}
+			sb.WriteString(regexp.QuoteMeta(item.str))
+			continue
+		case colorStart, colorEnd:
+			sb.WriteString(colorCodePattern)
+			continue
+		case logMessage, allFields, errorText, stackTrace:
+			if !startFound {
+				// these values may have multi lines, anchor the record by the text before them
+				startExpr = sb.String()
+				startFound = true
+			}
+			if item.kind == allFields {
+				sb.WriteString(fieldsPattern)
+			} else {
+				sb.WriteString(`((?s:.*?))`)
+			}
+		case loggerLevel, loggerLevelLower, loggerLevelUpper:
+			sb.WriteString(`\s*([A-Za-z]+)\s*`)
+		case timestamp:
+			sb.WriteString(`\s*(` + timeRegex(item.layout) + `)\s*`)
+		default:
+			sb.WriteString(`(.*?)`)
+		}
+		p.groupItem = append(p.groupItem, idx)
+	}
+	sb.WriteString(`$`)
+	if p.regex, err = regexp.Compile(sb.String()); err != nil {
+		return nil, err
+	}
+	if !startFound {
+		startExpr = sb.String()
+	}
+	if startExpr != "^" {
+		if p.start, err = regexp.Compile(startExpr); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Parse parse one record from text, text should include the trailing line break if the pattern has
+func (p *PatternParser) Parse(text string) (LogRecord, error) {
+	matches := p.regex.FindStringSubmatch(text)
+	if matches == nil {
+		return LogRecord{}, errors.New("log text does not match pattern: " + strconv.Quote(text))
+	}
+	var record LogRecord
+	for group, idx := range p.groupItem {
+		item := &p.items[idx]
+		value := matches[group+1]
+		if len(item.filters) > 0 || item.width != nil {
+			value = strings.TrimSpace(value)
+		}
+		switch item.kind {
+		case loggerName:
+			record.LoggerName = value
+		case loggerLevel, loggerLevelLower, loggerLevelUpper:
+			level, ok := levelNamesMap[strings.ToUpper(value)]
+			if !ok {
+				return record, errors.New("unknown log level: " + value)
+			}
+			record.Level = level
+		case timestamp:
+			ts, err := parseTime(value, item.layout, item.location)
+			if err != nil {
+				return record, wrapError("parse log time error", err)
+			}
+			record.LogTime = ts
+		case logMessage:
+			record.Message = value
+		case oneField:
+			if value != "" {
+				record.Fields = append(record.Fields, F(item.str, value))
+			}
+		case allFields:
+			fields, err := parseFields(value)
+			if err != nil {
+				return record, err
+			}
+			record.Fields = append(record.Fields, fields...)
+		case errorText:
+			if value != "" {
+				record.Fields = append(record.Fields, F("error", value))
+			}
+		case stackTrace:
+			if value != "" {
+				record.Fields = append(record.Fields, F("stack", value))
+			}
+		}
+	}
+	return record, nil
+}
+
+// the elements of time layout formatted with variable forms: zones, and fractional seconds with trailing zeros
+// removed. Longer ones first.
+var variableLayoutElements = regexp.MustCompile(
+	`Z07:00:00|Z070000|Z07:00|Z0700|Z07|-07:00:00|-070000|-07:00|-0700|-07|MST|[.,]9+`)
+
+// the regex matching zone names and offsets. Zones without abbreviation are named by offsets, like "+08".
+const zoneRegex = `(?:[A-Z]{2,5}|Z|[+-]\d{2}(?::?\d{2}){0,2})`
+
+// the regex matching time formatted with layout. Digits and letters are matched loosely, as their widths may vary.
+func timeRegex(layout string) string {
+	switch layout {
+	case epochSeconds, epochMillis, epochMicros, epochNanos:
+		return `-?\d+`
+	case "":
+		layout = "2006-01-02 15:04:05.000"
+	}
+	var sb strings.Builder
+	for {
+		loc := variableLayoutElements.FindStringIndex(layout)
+		if loc == nil {
+			sb.WriteString(fixedTimeRegex(layout))
+			return sb.String()
+		}
+		sb.WriteString(fixedTimeRegex(layout[:loc[0]]))
+		if element := layout[loc[0]:loc[1]]; element[0] == '.' || element[0] == ',' {
+			// omitted if zero
+			sb.WriteString(`(?:[.,]\d+)?`)
+		} else {
+			sb.WriteString(zoneRegex)
+		}
+		layout = layout[loc[1]:]
+	}
+}
+
+// the regex matching time formatted with layout without variable elements
+func fixedTimeRegex(layout string) string {
+	sample := time.Date(2006, 1, 2, 15, 4, 5, 123456789, time.UTC).Format(layout)
+	var sb strings.Builder
+	for idx := 0; idx < len(sample); {
+		c := sample[idx]
+		end := idx + 1
+		switch {
+		case c >= '0' && c <= '9', c == ' ' && end < len(sample) && sample[end] >= '0' && sample[end] <= '9':
+			// digits, may be padded with space for _2 layout
+			for end < len(sample) && sample[end] >= '0' && sample[end] <= '9' {
+				end++
+			}
+			sb.WriteString(`\s*\d+`)
+		case c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+			for end < len(sample) && (sample[end] >= 'A' && sample[end] <= 'Z' || sample[end] >= 'a' && sample[end] <= 'z') {
+				end++
+			}
+			sb.WriteString(`[A-Za-z]+`)
+		default:
+			sb.WriteString(regexp.QuoteMeta(sample[idx:end]))
+		}
+		idx = end
+	}
+	return sb.String()
+}
+
+// parse time formatted by appendTime
+func parseTime(value string, layout string, location *time.Location) (time.Time, error) {
+	var unit time.Duration
+	switch layout {
+	case epochSeconds:
+		unit = time.Second
+	case epochMillis:
+		unit = time.Millisecond
+	case epochMicros:
+		unit = time.Microsecond
+	case epochNanos:
+		unit = time.Nanosecond
+	}
+	if unit > 0 {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, 0).Add(time.Duration(n) * unit), nil
+	}
+	if location == nil {
+		location = DefaultTimeZone()
+	}
+	if location == nil {
+		location = time.Local
+	}
+	if layout == "" {
+		layout = "2006-01-02 15:04:05.000"
+	}
+	return time.ParseInLocation(layout, value, location)
+}
+
+// parse fields output by {fields}, as key=value pairs delimited by white space, values may be quoted
+func parseFields(str string) ([]Field, error) {
+	var fields []Field
+	for {
+		str = strings.TrimLeft(str, " ")
+		if str == "" {
+			return fields, nil
+		}
+		eq := strings.IndexByte(str, '=')
+		if eq <= 0 {
+			return fields, errors.New("invalid fields: " + str)
+		}
+		key := str[:eq]
+		str = str[eq+1:]
+		var value string
+		if strings.HasPrefix(str, `"`) {
+			end := quotedEnd(str)
+			if end < 0 {
+				return fields, errors.New("invalid quoted field value: " + str)
+			}
+			unquoted, err := strconv.Unquote(str[:end])
+			if err != nil {
+				return fields, errors.New("invalid quoted field value: " + str[:end])
+			}
+			value, str = unquoted, str[end:]
+		} else if sp := strings.IndexByte(str, ' '); sp >= 0 {
+			value, str = str[:sp], str[sp:]
+		} else {
+			value, str = str, ""
+		}
+		fields = append(fields, F(key, value))
+	}
+}
+
+// the end index of go quoted string at the start of str, -1 if not found
+func quotedEnd(str string) int {
+	for idx := 1; idx < len(str); idx++ {
+		switch str[idx] {
+		case '\\':
+			idx++
+		case '"':
+			return idx + 1
+		}
+	}
+	return -1
+}
+
+// LogReader read LogRecords from log text, using PatternParser.
+// Lines not matching the start of pattern are treated as continuation of previous record, for multi-line messages.
+type LogReader struct {
+	parser  *PatternParser
+	reader  *bufio.Reader
+	pending string // the first line of next record
+	eof     bool   // the reader reached EOF in current Next call
+}
+
+// NewReader create LogReader reading records from r
+func (p *PatternParser) NewReader(r io.Reader) *LogReader {
+	return &LogReader{parser: p, reader: bufio.NewReader(r)}
+}
+
+// Next read and parse next record. Return io.EOF if there is no more records.
+// If the record text does not match pattern, an error is returned, and the next call continue with following records.
+// Lines before the first record are skipped. The last record is returned when the reader reaches EOF; Next can be
+// called again after io.EOF, to read the records appended later, as when following a log file.
+func (r *LogReader) Next() (LogRecord, error) {
+	var sb strings.Builder
+	for {
+		line := r.pending
+		r.pending = ""
+		if line == "" {
+			if r.eof {
+				r.eof = false
+				break
+			}
+			var err error
+			line, err = r.reader.ReadString('\n')
+			if err == io.EOF {
+				r.eof = true
+			} else if err != nil {
+				return LogRecord{}, err
+			}
+			if line == "" {
+				continue
+			}
+		}
+		isStart := r.parser.start == nil || r.parser.start.MatchString(line)
+		if isStart && sb.Len() > 0 {
+			r.pending = line
+			break
+		}
+		if isStart || sb.Len() > 0 {
+			sb.WriteString(line)
+		}
+		if r.parser.start == nil {
+			break
+		}
+	}
+	if sb.Len() == 0 {
+		return LogRecord{}, io.EOF
+	}
+	return r.parser.Parse(sb.String())
+}
+
+// OpenLogFiles open the log file and its rotated files as one reader, rotated files first, in the order of suffixes.
+// Rotated files are discovered as FileAppender names them, gzipped rotated files (with .gz extension) are decompressed.
+func OpenLogFiles(path string) (io.ReadCloser, error) {
+	files, err := LogFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	return &multiFileReader{paths: files}, nil
+}
+
+// LogFiles return the log file and its rotated files which exist, rotated files first, in the order of suffixes.
+func LogFiles(path string) ([]string, error) {
+	dir, _ := filepath.Split(path)
+	if _, err := os.Stat(dirOrCurrent(dir)); err != nil {
+		return nil, err
+	}
+	files := rotatedLogFiles(path)
+	sort.SliceStable(files, func(i, j int) bool {
+		return suffixLess(files[i].suffix, files[j].suffix)
+	})
+
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// compare rotated file suffixes, numerically if both are numbers
+func suffixLess(s1 string, s2 string) bool {
+	n1, err1 := strconv.ParseInt(s1, 10, 64)
+	n2, err2 := strconv.ParseInt(s2, 10, 64)
+	if err1 == nil && err2 == nil {
+		return n1 < n2
+	}
+	return s1 < s2
+}
+
+// multiFileReader read files one by one
+type multiFileReader struct {
+	paths   []string
+	file    *os.File
+	current io.Reader
+}
+
+func (m *multiFileReader) Read(p []byte) (int, error) {
+	for {
+		if m.current == nil {
+			if len(m.paths) == 0 {
+				return 0, io.EOF
+			}
+			if err := m.open(m.paths[0]); err != nil {
+				return 0, err
+			}
+			m.paths = m.paths[1:]
+		}
+		n, err := m.current.Read(p)
+		if err == io.EOF {
+			m.closeCurrent()
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (m *multiFileReader) open(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	m.file, m.current = file, file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return wrapError("open gzipped log file "+path+" error", err)
+		}
+		m.current = gz
+	}
+	return nil
+}
+
+func (m *multiFileReader) closeCurrent() {
+	if m.file != nil {
+		m.file.Close()
+	}
+	m.file, m.current = nil, nil
+}
+
+// Close close the file being read
+func (m *multiFileReader) Close() error {
+	m.closeCurrent()
+	m.paths = nil
+	return nil
+}
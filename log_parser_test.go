@@ -0,0 +1,149 @@
+package vlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatternParser_Parse(t *testing.T) {
+	pattern := "{time|2006-01-02T15:04:05.000|UTC} {color:level}[{Level|-5}]{/color} {logger|abbr|20} - {message} {fields}\n"
+	transformer := MustNewPatternTransformer(pattern)
+	parser, err := NewPatternParser(pattern)
+	assert.NoError(t, err)
+
+	ts := time.Date(2019, 10, 1, 12, 30, 5, 123000000, time.UTC)
+	record := LogRecord{LoggerName: "app", Level: Warn, LogTime: ts, Message: "disk\nalmost full",
+		Fields: []Field{F("used", "95%"), F("path", "/data dir")}}
+	parsed, err := parser.Parse(string(transformer.Transform(record).Message))
+	assert.NoError(t, err)
+	assert.Equal(t, "app", parsed.LoggerName)
+	assert.Equal(t, Warn, parsed.Level)
+	assert.True(t, ts.Equal(parsed.LogTime))
+	assert.Equal(t, "disk\nalmost full", parsed.Message)
+	assert.Equal(t, []Field{F("used", "95%"), F("path", "/data dir")}, parsed.Fields)
+
+	_, err = parser.Parse("not a log\n")
+	assert.Error(t, err)
+
+	parser, _ = NewPatternParser("{time|unixmilli} {level} {field:user|default:-} {message}")
+	parsed, err = parser.Parse("1569904200123 error bob login failed")
+	assert.NoError(t, err)
+	assert.Equal(t, Error, parsed.Level)
+	assert.Equal(t, int64(1569904200123), parsed.LogTime.UnixNano()/int64(time.Millisecond))
+	assert.Equal(t, []Field{F("user", "bob")}, parsed.Fields)
+	assert.Equal(t, "login failed", parsed.Message)
+}
+
+func TestLogReader(t *testing.T) {
+	transformer := NewDefaultPatternTransformer()
+	ts := time.Date(2019, 10, 1, 12, 30, 5, 0, time.Local)
+	var sb strings.Builder
+	sb.WriteString("garbage before first record\n")
+	records := []LogRecord{
+		{LoggerName: "app", Level: Info, LogTime: ts, Message: "started"},
+		{LoggerName: "app/db", Level: Error, LogTime: ts.Add(time.Second), Message: "query failed\n\tat line 1\n\n"},
+		{LoggerName: "app", Level: Debug, LogTime: ts.Add(2 * time.Second), Message: "done"},
+	}
+	for _, record := range records {
+		sb.Write(transformer.Transform(record).Message)
+	}
+
+	parser, err := NewPatternParser(transformer.pattern)
+	assert.NoError(t, err)
+	reader := parser.NewReader(strings.NewReader(sb.String()))
+	for _, expected := range records {
+		record, err := reader.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, expected.LoggerName, record.LoggerName)
+		assert.Equal(t, expected.Level, record.Level)
+		assert.Equal(t, expected.Message, record.Message)
+		assert.True(t, expected.LogTime.Equal(record.LogTime))
+	}
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestLogReader_TimeZone(t *testing.T) {
+	for _, layout := range []string{"2006-01-02T15:04:05Z07:00", "2006-01-02 15:04:05.999999999 -0700 MST"} {
+		pattern := "{time|" + layout + "} {message}\n"
+		transformer := MustNewPatternTransformer(pattern)
+		parser, err := NewPatternParser(pattern)
+		assert.NoError(t, err)
+		var sb strings.Builder
+		zone := time.FixedZone("CST", 8*3600)
+		records := []LogRecord{
+			{LogTime: time.Date(2019, 10, 1, 12, 30, 5, 0, zone), Message: "failed\ncaused by: timeout"},
+			{LogTime: time.Date(2019, 10, 1, 12, 30, 6, 500, time.UTC), Message: "done"},
+		}
+		for _, record := range records {
+			sb.Write(transformer.Transform(record).Message)
+		}
+		reader := parser.NewReader(strings.NewReader(sb.String()))
+		for _, expected := range records {
+			record, err := reader.Next()
+			assert.NoError(t, err, layout)
+			assert.Equal(t, expected.Message, record.Message, layout)
+			assert.True(t, expected.LogTime.Truncate(time.Second).Equal(record.LogTime.Truncate(time.Second)), layout)
+		}
+		_, err = reader.Next()
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestLogReader_Appended(t *testing.T) {
+	transformer := NewDefaultPatternTransformer()
+	parser, err := NewPatternParser(transformer.pattern)
+	assert.NoError(t, err)
+	var buffer bytes.Buffer
+	reader := parser.NewReader(&buffer)
+	buffer.Write(transformer.Transform(LogRecord{LoggerName: "app", Level: Info, Message: "first"}).Message)
+	record, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", record.Message)
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+
+	// records appended after EOF are read
+	buffer.Write(transformer.Transform(LogRecord{LoggerName: "app", Level: Info, Message: "second"}).Message)
+	record, err = reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "second", record.Message)
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestOpenLogFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("current\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.10.log"), []byte("10\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.9.log"), []byte("9\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.1.log"), []byte("other\n"), 0644))
+	gzFile, err := os.Create(filepath.Join(dir, "app.8.log.gz"))
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(gzFile)
+	_, _ = gz.Write([]byte("8\n"))
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, gzFile.Close())
+
+	reader, err := OpenLogFiles(path)
+	assert.NoError(t, err)
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "8\n9\n10\ncurrent\n", string(data))
+
+	_, err = OpenLogFiles(filepath.Join(dir, "missing", "app.log"))
+	assert.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+}
@@ -1,6 +1,7 @@
 package vlog
 
 import (
+	"context"
 	"fmt"
 	"golang.org/x/time/rate"
 	"os"
@@ -12,6 +13,13 @@ import (
 
 var errLogRateLimiter = rate.NewLimiter(rate.Limit(10.0), 10)
 
+// reportError print vlog internal errors to stderr, with rate limit
+func reportError(message string, err error) {
+	if errLogRateLimiter.Allow() {
+		_, _ = fmt.Fprintln(os.Stderr, message, err)
+	}
+}
+
 // Level the logger level
 type Level int32
 
@@ -47,6 +55,7 @@ type Logger struct {
 	level     int32          //Level
 	appenders unsafe.Pointer //*[]Appender
 	frozen    bool           // frozen level. the level is set by env, following level set in code will not take effect
+	sampler   unsafe.Pointer //*Sampler
 }
 
 // Name the name of this logger
@@ -95,6 +104,19 @@ func (l *Logger) AddAppenders(appenders ...Appender) {
 	}
 }
 
+// SetSampler set sampler to limit records of noisy log statements. Set nil to disable sampling, which is the default.
+func (l *Logger) SetSampler(sampler *Sampler) {
+	if sampler != nil {
+		sampler.start()
+	}
+	atomic.StorePointer(&l.sampler, unsafe.Pointer(sampler))
+}
+
+// Sampler return the sampler of this logger, nil if not set
+func (l *Logger) Sampler() *Sampler {
+	return (*Sampler)(atomic.LoadPointer(&l.sampler))
+}
+
 // SetTransformerForAppenders set transformer, apply to all appenders the logger current have
 func (l *Logger) SetTransformerForAppenders(transformer Transformer) {
 	for _, appender := range l.Appenders() {
@@ -132,6 +154,20 @@ func (l *Logger) Critical(firstArg interface{}, args ...interface{}) {
 	l.log(Critical, firstArg, args...)
 }
 
+// Fatal log message with critical level, then close all appenders by CloseAppenders, and exit process with code 1.
+// The exit func can be replaced by SetExitFunc for testing.
+func (l *Logger) Fatal(firstArg interface{}, args ...interface{}) {
+	l.log(Critical, firstArg, args...)
+	exit()
+}
+
+// Panic log message with critical level, then flush all appenders by FlushAppenders, and panic with the message
+func (l *Logger) Panic(firstArg interface{}, args ...interface{}) {
+	l.log(Critical, firstArg, args...)
+	flushAfterPanic()
+	panic(argsMessage(firstArg, args))
+}
+
 // TraceFormat log message with trace level
 func (l *Logger) TraceFormat(format string, args ...interface{}) {
 	l.logFormat(Trace, format, args...)
@@ -162,6 +198,41 @@ func (l *Logger) CriticalFormat(format string, args ...interface{}) {
 	l.logFormat(Critical, format, args...)
 }
 
+// FatalFormat log message with critical level, then close all appenders by CloseAppenders, and exit process with
+// code 1. The exit func can be replaced by SetExitFunc for testing.
+func (l *Logger) FatalFormat(format string, args ...interface{}) {
+	l.logFormat(Critical, format, args...)
+	exit()
+}
+
+// PanicFormat log message with critical level, then flush all appenders by FlushAppenders, and panic with the message
+func (l *Logger) PanicFormat(format string, args ...interface{}) {
+	l.logFormat(Critical, format, args...)
+	flushAfterPanic()
+	args, _, _ = splitArgs(args)
+	panic(formatMessage(format, args...))
+}
+
+var exitFunc atomic.Value // func(code int)
+
+// SetExitFunc set the func called by Fatal/FatalFormat to exit process, for testing.
+// Set nil to use os.Exit, which is the default.
+func SetExitFunc(exit func(code int)) {
+	exitFunc.Store(exit)
+}
+
+// close all appenders, and exit process with code 1
+func exit() {
+	if err := CloseAppenders(); err != nil {
+		reportError("close appenders error", err)
+	}
+	if exit, _ := exitFunc.Load().(func(code int)); exit != nil {
+		exit(1)
+		return
+	}
+	os.Exit(1)
+}
+
 // TraceEnabled if this logger log trace message
 func (l *Logger) TraceEnabled() bool {
 	return l.Level() <= Trace
@@ -244,11 +315,29 @@ func (l *Logger) CriticalLazy(f func() string) {
 func (l *Logger) log(level Level, firstArg interface{}, args ...interface{}) {
 	appenders := l.Appenders()
 	if l.Level() <= level && len(appenders) > 0 {
-		message := joinMessage(firstArg, args...)
-		if err := l.writeToAppends(level, appenders, message); err != nil {
-			if errLogRateLimiter.Allow() {
-				_, _ = fmt.Fprintln(os.Stderr, "log error", err)
+		var firstCtx context.Context
+		if ctx, ok := firstArg.(context.Context); ok && len(args) > 0 {
+			// called as logger.Info(ctx, message...)
+			firstCtx, firstArg, args = ctx, args[0], args[1:]
+		}
+		// critical records, including Fatal and Panic, are not sampled
+		if sampler := l.Sampler(); sampler != nil && level < Critical {
+			template, ok := firstArg.(string)
+			if !ok {
+				template = joinMessage(firstArg)
 			}
+			if !sampler.allow(l, level, template) {
+				return
+			}
+		}
+		args, fields, ctx := splitArgs(args)
+		if ctx == nil {
+			ctx = firstCtx
+		}
+		message := joinMessage(firstArg, args...)
+		record := LogRecord{Level: level, Message: message, Fields: fields, Context: ctx}
+		if err := l.writeToAppends(appenders, record); err != nil {
+			reportError("log error", err)
 		}
 	}
 }
@@ -257,10 +346,11 @@ func (l *Logger) log(level Level, firstArg interface{}, args ...interface{}) {
 func (l *Logger) logString(level Level, message string) {
 	appenders := l.Appenders()
 	if l.Level() <= level && len(appenders) > 0 {
-		if err := l.writeToAppends(level, appenders, message); err != nil {
-			if errLogRateLimiter.Allow() {
-				_, _ = fmt.Fprintln(os.Stderr, "log error", err)
-			}
+		if sampler := l.Sampler(); sampler != nil && !sampler.allow(l, level, message) {
+			return
+		}
+		if err := l.writeToAppends(appenders, LogRecord{Level: level, Message: message}); err != nil {
+			reportError("log error", err)
 		}
 	}
 }
@@ -269,21 +359,37 @@ func (l *Logger) logString(level Level, message string) {
 func (l *Logger) logFormat(level Level, format string, args ...interface{}) {
 	appenders := l.Appenders()
 	if l.Level() <= level && len(appenders) > 0 {
+		if sampler := l.Sampler(); sampler != nil && level < Critical && !sampler.allow(l, level, format) {
+			return
+		}
+		args, fields, ctx := splitArgs(args)
 		message := formatMessage(format, args...)
-		if err := l.writeToAppends(level, appenders, message); err != nil {
-			if errLogRateLimiter.Allow() {
-				_, _ = fmt.Fprintln(os.Stderr, "log error", err)
-			}
+		record := LogRecord{Level: level, Message: message, Fields: fields, Context: ctx}
+		if err := l.writeToAppends(appenders, record); err != nil {
+			reportError("log error", err)
 		}
 	}
 }
 
-func (l *Logger) writeToAppends(level Level, appenders []Appender, message string) error {
-	now := time.Now()
+// fill logger name and time of record, and write to appenders
+func (l *Logger) writeToAppends(appenders []Appender, record LogRecord) error {
+	record.LoggerName = l.Name()
+	record.LogTime = time.Now()
+	if redactor := currentRedactor(); redactor != nil {
+		record = redactor.redactRecord(record)
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
 	//TODO: async, parallel write
 	for _, appender := range appenders {
-		transformer := appender.Transformer()
-		appendEvent := transformer.Transform(LogRecord{l.Name(), level, now, message})
+		var appendEvent AppendEvent
+		switch transformer := appender.Transformer().(type) {
+		case AppendTransformer:
+			buf.b = transformer.AppendTransform(buf.b[:0], record)
+			appendEvent = AppendEvent{LoggerName: record.LoggerName, Level: record.Level, Message: buf.b}
+		default:
+			appendEvent = transformer.Transform(record)
+		}
 		err := appender.Append(appendEvent)
 		if err != nil {
 			//TODO: collection errors
@@ -293,37 +399,47 @@ func (l *Logger) writeToAppends(level Level, appenders []Appender, message strin
 	return nil
 }
 
-func joinMessage(message interface{}, args ...interface{}) string {
-	var results = make([]string, len(args)+1)
-	results[0] = argToString(message)
-	for idx := 0; idx < len(args); idx++ {
-		results[idx+1] = argToString(args[idx])
+// the message joined from log args, without fields and context
+func argsMessage(firstArg interface{}, args []interface{}) string {
+	if _, ok := firstArg.(context.Context); ok && len(args) > 0 {
+		firstArg, args = args[0], args[1:]
 	}
+	args, _, _ = splitArgs(args)
+	return joinMessage(firstArg, args...)
+}
 
-	return strings.Join(results, " ")
+func joinMessage(message interface{}, args ...interface{}) string {
+	if str, ok := message.(string); ok && len(args) == 0 {
+		return str
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	appendArg(buf, message)
+	for _, arg := range args {
+		buf.b = append(buf.b, ' ')
+		appendArg(buf, arg)
+	}
+	return string(buf.b)
 }
 
+// format message by replacing {} placeholders with args in order. Redundant placeholders or args are kept/ignored.
 func formatMessage(format string, args ...interface{}) string {
-	argNum := len(args)
-	items := strings.SplitN(format, "{}", argNum+1)
-
-	var results []string
-	var minArgNum = len(items) - 1
-	if minArgNum > argNum {
-		minArgNum = argNum
+	if len(args) == 0 {
+		return format
 	}
-
-	for idx, item := range items {
-		results = append(results, item)
-		if idx < minArgNum {
-			results = append(results, argToString(args[idx]))
+	buf := getBuffer()
+	defer putBuffer(buf)
+	for _, arg := range args {
+		idx := strings.Index(format, "{}")
+		if idx < 0 {
+			break
 		}
+		buf.b = append(buf.b, format[:idx]...)
+		appendArg(buf, arg)
+		format = format[idx+2:]
 	}
-	return strings.Join(results, "")
-}
-
-func argToString(arg interface{}) string {
-	return fmt.Sprint(arg)
+	buf.b = append(buf.b, format...)
+	return string(buf.b)
 }
 
 // GetLogger return the logger with name
@@ -331,6 +447,12 @@ func GetLogger(name string) *Logger {
 	return loggerCache.Load(name)
 }
 
+// FilterLoggers return loggers already created, with name matching the prefix.
+// prefix match logger names as VLOG_LEVEL env does, empty prefix match all loggers.
+func FilterLoggers(prefix string) []*Logger {
+	return loggerCache.Filter(prefix)
+}
+
 // CurrentPackageLogger return the log of current package, use package name as logger name
 func CurrentPackageLogger() *Logger {
 	caller := getCaller(2)
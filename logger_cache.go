@@ -106,6 +106,13 @@ func (lc *LoggerCache) matchConfig(name string) *loggerConfig {
 	return config
 }
 
+// Filter return loggers already created, with name matching the prefix, as VLOG_LEVEL env matching logger names.
+func (lc *LoggerCache) Filter(prefix string) []*Logger {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+	return lc.filter(prefix)
+}
+
 func (lc *LoggerCache) filter(prefix string) []*Logger {
 	var loggers []*Logger
 	for _, logger := range lc.loggerMap {
@@ -116,6 +123,12 @@ func (lc *LoggerCache) filter(prefix string) []*Logger {
 	return loggers
 }
 
+// MatchLoggerPrefix return if logger name matches the prefix, as VLOG_LEVEL env and Filter matching logger names.
+// Empty prefix matches all names; otherwise the name should equal to prefix, or start with prefix at a '/' boundary.
+func MatchLoggerPrefix(name string, prefix string) bool {
+	return matchPrefix(name, prefix)
+}
+
 func matchPrefix(name string, prefix string) bool {
 	if len(prefix) == 0 {
 		return true
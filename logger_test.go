@@ -1,6 +1,10 @@
 package vlog
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -71,6 +75,44 @@ func TestLogger_AddAppender(t *testing.T) {
 	assert.Equal(t, appender, logger.Appenders()[1])
 }
 
+func TestLogger_Fatal(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fatal.log")
+	appender, err := NewFileAppender(path, nil)
+	assert.NoError(t, err)
+	appender.SetBuffer(4096, time.Hour, Off)
+	appender.SetTransformer(MustNewPatternTransformer("{Level} {message}\n"))
+
+	var codes []int
+	SetExitFunc(func(code int) { codes = append(codes, code) })
+	defer SetExitFunc(nil)
+
+	logger := GetLogger("vlog/test/fatal")
+	logger.SetAppenders(appender)
+	logger.Fatal("server stopped:", errors.New("port in use"))
+	assert.Equal(t, []int{1}, codes)
+	assert.Equal(t, "Critical server stopped: port in use\n", readFile(t, path))
+
+	logger.FatalFormat("server {} stopped", "s1")
+	assert.Equal(t, []int{1, 1}, codes)
+}
+
+func TestLogger_Panic(t *testing.T) {
+	appender := NewBytesAppender()
+	appender.SetTransformer(MustNewPatternTransformer("{Level} {message}\n"))
+	logger := GetLogger("vlog/test/panic")
+	logger.SetAppenders(appender)
+
+	assert.PanicsWithValue(t, "invalid state: 3", func() {
+		logger.Panic("invalid state:", 3, F("state", 3))
+	})
+	assert.PanicsWithValue(t, "invalid state 3", func() {
+		logger.PanicFormat("invalid state {}", 3, F("state", 3))
+	})
+	assert.Equal(t, "Critical invalid state: 3\nCritical invalid state 3\n", appender.buffer.String())
+}
+
 func TestFormatMessage(t *testing.T) {
 	assert.Equal(t, "This is a test", formatMessage("This is a test"), "")
 	assert.Equal(t, "This is 1", formatMessage("This is {}", 1), "")
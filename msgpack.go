@@ -0,0 +1,204 @@
+package vlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// minimal MessagePack encoding helpers, for appenders sending msgpack data without depending on msgpack libs
+
+func appendMsgpackArrayHeader(buf []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(buf, 0xdc, byte(n>>8), byte(n))
+	default:
+		return append(buf, 0xdd, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMsgpackMapHeader(buf []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(buf, 0xde, byte(n>>8), byte(n))
+	default:
+		return append(buf, 0xdf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMsgpackString(buf []byte, str string) []byte {
+	n := len(str)
+	switch {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xda, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(buf, str...)
+}
+
+func appendMsgpackInt(buf []byte, v int64) []byte {
+	if v >= 0 {
+		return appendMsgpackUint(buf, uint64(v))
+	}
+	if v >= -32 {
+		return append(buf, byte(v))
+	}
+	buf = append(buf, 0xd3)
+	return appendUint64BE(buf, uint64(v))
+}
+
+func appendMsgpackUint(buf []byte, v uint64) []byte {
+	if v < 128 {
+		return append(buf, byte(v))
+	}
+	buf = append(buf, 0xcf)
+	return appendUint64BE(buf, v)
+}
+
+func appendMsgpackFloat(buf []byte, v float64) []byte {
+	buf = append(buf, 0xcb)
+	return appendUint64BE(buf, math.Float64bits(v))
+}
+
+func appendMsgpackBool(buf []byte, v bool) []byte {
+	if v {
+		return append(buf, 0xc3)
+	}
+	return append(buf, 0xc2)
+}
+
+func appendMsgpackNil(buf []byte) []byte {
+	return append(buf, 0xc0)
+}
+
+// append time as fluentd EventTime, ext type 0 with 4 bytes seconds and 4 bytes nanoseconds
+func appendMsgpackEventTime(buf []byte, t time.Time) []byte {
+	buf = append(buf, 0xd7, 0x00)
+	var data [8]byte
+	binary.BigEndian.PutUint32(data[:4], uint32(t.Unix()))
+	binary.BigEndian.PutUint32(data[4:], uint32(t.Nanosecond()))
+	return append(buf, data[:]...)
+}
+
+func appendUint64BE(buf []byte, v uint64) []byte {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], v)
+	return append(buf, data[:]...)
+}
+
+// append a field value, values are converted by fieldValue first
+func appendMsgpackValue(buf []byte, value interface{}) []byte {
+	switch v := fieldValue(value).(type) {
+	case nil:
+		return appendMsgpackNil(buf)
+	case string:
+		return appendMsgpackString(buf, v)
+	case bool:
+		return appendMsgpackBool(buf, v)
+	case int:
+		return appendMsgpackInt(buf, int64(v))
+	case int8:
+		return appendMsgpackInt(buf, int64(v))
+	case int16:
+		return appendMsgpackInt(buf, int64(v))
+	case int32:
+		return appendMsgpackInt(buf, int64(v))
+	case int64:
+		return appendMsgpackInt(buf, v)
+	case uint:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint8:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint16:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint32:
+		return appendMsgpackUint(buf, uint64(v))
+	case uint64:
+		return appendMsgpackUint(buf, v)
+	case float64:
+		return appendMsgpackFloat(buf, v)
+	default:
+		// fieldValue only return the types above
+		return appendMsgpackNil(buf)
+	}
+}
+
+var errMsgpackUnsupported = errors.New("unsupported msgpack type")
+
+// read a msgpack map with string keys and string values, such as fluentd ack response
+func readMsgpackStringMap(reader *bufio.Reader) (map[string]string, error) {
+	b, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	switch {
+	case b&0xf0 == 0x80:
+		n = int(b & 0x0f)
+	case b == 0xde:
+		var data [2]byte
+		if _, err := io.ReadFull(reader, data[:]); err != nil {
+			return nil, err
+		}
+		n = int(binary.BigEndian.Uint16(data[:]))
+	default:
+		return nil, errMsgpackUnsupported
+	}
+
+	var m = make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key, err := readMsgpackString(reader)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readMsgpackString(reader)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+func readMsgpackString(reader *bufio.Reader) (string, error) {
+	b, err := reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case b&0xe0 == 0xa0:
+		n = int(b & 0x1f)
+	case b == 0xd9:
+		l, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		n = int(l)
+	case b == 0xda:
+		var data [2]byte
+		if _, err := io.ReadFull(reader, data[:]); err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint16(data[:]))
+	default:
+		return "", errMsgpackUnsupported
+	}
+	var data = make([]byte, n)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,326 @@
+package vlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// OTLPProtocol is the body encoding of OTLP/HTTP request
+type OTLPProtocol int
+
+// OTLP/HTTP body encodings
+const (
+	OTLPProtobuf OTLPProtocol = 0
+	OTLPJSON     OTLPProtocol = 1
+)
+
+// SpanContextExtractor extract trace id and span id from the context passed to logger.
+// vlog does not depend on OpenTelemetry sdk, user should provide this to fill trace id and span id for OTLP log records,
+// for example, using trace.SpanContextFromContext of OpenTelemetry go sdk.
+type SpanContextExtractor func(ctx context.Context) (traceID [16]byte, spanID [8]byte, ok bool)
+
+// otlpSeverityMap map vlog levels to OTLP severity numbers
+var otlpSeverityMap = map[Level]uint64{
+	Trace:    1,
+	Debug:    5,
+	Info:     9,
+	Warn:     13,
+	Error:    17,
+	Critical: 21,
+}
+
+var _ Transformer = (*OTLPTransformer)(nil)
+
+// OTLPTransformer transform log record to one OTLP LogRecord, encoded as protobuf or json.
+// The transformed messages should be sent by OTLPEncoder with the same protocol, they are not readable text.
+//
+// The log message is set as body, the fields and caller are set as attributes, caller attributes are named following
+// OpenTelemetry semantic conventions: code.function.name, code.file.path, code.line.number.
+// Errors passed by vlog.Err/vlog.ErrWithStack are set as exception.type, exception.message and exception.stacktrace.
+// If record has context and extractor is set, trace id and span id are set from the context.
+type OTLPTransformer struct {
+	protocol  OTLPProtocol
+	extractor SpanContextExtractor
+}
+
+// NewOTLPTransformer create OTLP transformer. extractor can be nil if not need trace id and span id.
+func NewOTLPTransformer(protocol OTLPProtocol, extractor SpanContextExtractor) *OTLPTransformer {
+	return &OTLPTransformer{protocol: protocol, extractor: extractor}
+}
+
+// Transform convert log record to encoded OTLP LogRecord
+func (t *OTLPTransformer) Transform(record LogRecord) AppendEvent {
+	caller := getRecordCaller(&record, transformCallerDepth+record.callerSkip)
+	var attributes = make([]Field, 0, len(record.Fields)+3)
+	for _, field := range record.Fields {
+		if ev, ok := field.Value.(*errorValue); ok {
+			attributes = append(attributes, F("exception.type", errorType(ev.err)), F("exception.message", ev.Error()))
+			if len(ev.stack) > 0 {
+				attributes = append(attributes, F("exception.stacktrace", string(appendStack(nil, ev.stack))))
+			}
+			continue
+		}
+		attributes = append(attributes, field)
+	}
+	attributes = append(attributes,
+		F("code.function.name", caller.packageName+"."+caller.functionName),
+		F("code.file.path", caller.fileName),
+		F("code.line.number", caller.line),
+	)
+	var traceID []byte
+	var spanID []byte
+	if t.extractor != nil && record.Context != nil {
+		if tid, sid, ok := t.extractor(record.Context); ok {
+			traceID, spanID = tid[:], sid[:]
+		}
+	}
+
+	var message []byte
+	if t.protocol == OTLPJSON {
+		message = otlpJSONLogRecord(record, attributes, traceID, spanID)
+	} else {
+		message = otlpProtoLogRecord(record, attributes, traceID, spanID)
+	}
+	return AppendEvent{LoggerName: record.LoggerName, Level: record.Level, Message: message}
+}
+
+func otlpProtoLogRecord(record LogRecord, attributes []Field, traceID []byte, spanID []byte) []byte {
+	var buf []byte
+	ts := uint64(record.LogTime.UnixNano())
+	buf = appendProtoFixed64Field(buf, 1, ts)
+	buf = appendProtoVarintField(buf, 2, otlpSeverityMap[record.Level])
+	buf = appendProtoStringField(buf, 3, record.Level.Name())
+	buf = appendProtoBytesField(buf, 5, otlpProtoAnyValue(record.Message))
+	for _, attribute := range attributes {
+		buf = appendProtoBytesField(buf, 6, otlpProtoKeyValue(attribute.Key, attribute.Value))
+	}
+	if len(traceID) > 0 {
+		buf = appendProtoBytesField(buf, 9, traceID)
+		buf = appendProtoBytesField(buf, 10, spanID)
+	}
+	buf = appendProtoFixed64Field(buf, 11, ts)
+	return buf
+}
+
+func otlpProtoKeyValue(key string, value interface{}) []byte {
+	var buf []byte
+	buf = appendProtoStringField(buf, 1, key)
+	return appendProtoBytesField(buf, 2, otlpProtoAnyValue(value))
+}
+
+func otlpProtoAnyValue(value interface{}) []byte {
+	switch v := otlpValue(value).(type) {
+	case bool:
+		var b uint64
+		if v {
+			b = 1
+		}
+		return appendProtoVarintField(nil, 2, b)
+	case int64:
+		return appendProtoVarintField(nil, 3, uint64(v))
+	case float64:
+		return appendProtoDoubleField(nil, 4, v)
+	default:
+		return appendProtoStringField(nil, 1, v.(string))
+	}
+}
+
+func otlpJSONLogRecord(record LogRecord, attributes []Field, traceID []byte, spanID []byte) []byte {
+	var buffer bytes.Buffer
+	ts := strconv.FormatInt(record.LogTime.UnixNano(), 10)
+	buffer.WriteString(`{"timeUnixNano":"`)
+	buffer.WriteString(ts)
+	buffer.WriteString(`","observedTimeUnixNano":"`)
+	buffer.WriteString(ts)
+	buffer.WriteString(`","severityNumber":`)
+	buffer.WriteString(strconv.FormatUint(otlpSeverityMap[record.Level], 10))
+	buffer.WriteString(`,"severityText":`)
+	writeJSONString(&buffer, record.Level.Name())
+	buffer.WriteString(`,"body":`)
+	writeOTLPJSONAnyValue(&buffer, record.Message)
+	buffer.WriteString(`,"attributes":`)
+	writeOTLPJSONAttributes(&buffer, attributes)
+	if len(traceID) > 0 {
+		buffer.WriteString(`,"traceId":"`)
+		buffer.WriteString(hex.EncodeToString(traceID))
+		buffer.WriteString(`","spanId":"`)
+		buffer.WriteString(hex.EncodeToString(spanID))
+		buffer.WriteByte('"')
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes()
+}
+
+func writeOTLPJSONAttributes(buffer *bytes.Buffer, attributes []Field) {
+	buffer.WriteByte('[')
+	for idx, attribute := range attributes {
+		if idx > 0 {
+			buffer.WriteByte(',')
+		}
+		buffer.WriteString(`{"key":`)
+		writeJSONString(buffer, attribute.Key)
+		buffer.WriteString(`,"value":`)
+		writeOTLPJSONAnyValue(buffer, attribute.Value)
+		buffer.WriteByte('}')
+	}
+	buffer.WriteByte(']')
+}
+
+func writeOTLPJSONAnyValue(buffer *bytes.Buffer, value interface{}) {
+	switch v := otlpValue(value).(type) {
+	case bool:
+		buffer.WriteString(`{"boolValue":` + strconv.FormatBool(v) + `}`)
+	case int64:
+		// int64 values are encoded as string in OTLP json
+		buffer.WriteString(`{"intValue":"` + strconv.FormatInt(v, 10) + `"}`)
+	case float64:
+		buffer.WriteString(`{"doubleValue":` + strconv.FormatFloat(v, 'g', -1, 64) + `}`)
+	default:
+		buffer.WriteString(`{"stringValue":`)
+		writeJSONString(buffer, v.(string))
+		buffer.WriteByte('}')
+	}
+}
+
+// otlpValue convert value to one of bool, int64, float64, or string
+func otlpValue(value interface{}) interface{} {
+	switch v := fieldValue(value).(type) {
+	case bool:
+		return v
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return otlpUintValue(uint64(v))
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return otlpUintValue(v)
+	case float64:
+		return v
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func otlpUintValue(v uint64) interface{} {
+	if v > math.MaxInt64 {
+		return strconv.FormatUint(v, 10)
+	}
+	return int64(v)
+}
+
+var _ HTTPEncoder = (*OTLPEncoder)(nil)
+
+// OTLPEncoder encode log records transformed by OTLPTransformer to OTLP ExportLogsServiceRequest.
+// Records are grouped into scopes by logger name, the logger name is used as instrumentation scope name.
+type OTLPEncoder struct {
+	protocol OTLPProtocol
+	resource []Field
+}
+
+// NewOTLPEncoder create OTLP encoder. resource are the attributes of the OTLP resource, such as service.name.
+// If service.name is not set, use unknown_service:{executable name} as OpenTelemetry specification requires.
+func NewOTLPEncoder(protocol OTLPProtocol, resource ...Field) *OTLPEncoder {
+	var hasServiceName = false
+	for _, field := range resource {
+		if field.Key == "service.name" {
+			hasServiceName = true
+		}
+	}
+	var attributes = append([]Field(nil), resource...)
+	if !hasServiceName {
+		executable, _ := os.Executable()
+		attributes = append(attributes, F("service.name", "unknown_service:"+filepath.Base(executable)))
+	}
+	return &OTLPEncoder{protocol: protocol, resource: attributes}
+}
+
+// ContentType return application/x-protobuf or application/json, by protocol
+func (e *OTLPEncoder) ContentType() string {
+	if e.protocol == OTLPJSON {
+		return "application/json"
+	}
+	return "application/x-protobuf"
+}
+
+// Encode write ExportLogsServiceRequest with one ResourceLogs
+func (e *OTLPEncoder) Encode(buffer *bytes.Buffer, events []AppendEvent, times []int64) error {
+	var scopes []string
+	var scopeEvents = map[string][]int{}
+	for idx, event := range events {
+		if _, ok := scopeEvents[event.LoggerName]; !ok {
+			scopes = append(scopes, event.LoggerName)
+		}
+		scopeEvents[event.LoggerName] = append(scopeEvents[event.LoggerName], idx)
+	}
+
+	if e.protocol == OTLPJSON {
+		buffer.WriteString(`{"resourceLogs":[{"resource":{"attributes":`)
+		writeOTLPJSONAttributes(buffer, e.resource)
+		buffer.WriteString(`},"scopeLogs":[`)
+		for scopeIdx, scope := range scopes {
+			if scopeIdx > 0 {
+				buffer.WriteByte(',')
+			}
+			buffer.WriteString(`{"scope":{"name":`)
+			writeJSONString(buffer, scope)
+			buffer.WriteString(`},"logRecords":[`)
+			for idx, eventIdx := range scopeEvents[scope] {
+				if idx > 0 {
+					buffer.WriteByte(',')
+				}
+				buffer.Write(events[eventIdx].Message)
+			}
+			buffer.WriteString(`]}`)
+		}
+		buffer.WriteString(`]}]}`)
+		return nil
+	}
+
+	var resource []byte
+	for _, attribute := range e.resource {
+		resource = appendProtoBytesField(resource, 1, otlpProtoKeyValue(attribute.Key, attribute.Value))
+	}
+	var resourceLogs []byte
+	resourceLogs = appendProtoBytesField(resourceLogs, 1, resource)
+	for _, scope := range scopes {
+		var scopeLogs []byte
+		scopeLogs = appendProtoBytesField(scopeLogs, 1, appendProtoStringField(nil, 1, scope))
+		for _, eventIdx := range scopeEvents[scope] {
+			scopeLogs = appendProtoBytesField(scopeLogs, 2, events[eventIdx].Message)
+		}
+		resourceLogs = appendProtoBytesField(resourceLogs, 2, scopeLogs)
+	}
+	buffer.Write(appendProtoBytesField(nil, 1, resourceLogs))
+	return nil
+}
+
+// NewOTLPAppender create HTTPAppender export logs to OpenTelemetry collector, using OTLP/HTTP.
+// endpoint is the full url of logs api, such as http://localhost:4318/v1/logs.
+// resource are the attributes of the OTLP resource, such as service.name.
+// To set trace id and span id, set a OTLPTransformer with SpanContextExtractor to the appender.
+func NewOTLPAppender(endpoint string, protocol OTLPProtocol, resource ...Field) *HTTPAppender {
+	appender := NewHTTPAppender(endpoint, NewOTLPEncoder(protocol, resource...))
+	appender.SetTransformer(NewOTLPTransformer(protocol, nil))
+	return appender
+}
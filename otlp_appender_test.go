@@ -0,0 +1,148 @@
+package vlog
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type spanKey struct{}
+
+func testSpanContextExtractor(ctx context.Context) (traceID [16]byte, spanID [8]byte, ok bool) {
+	if v, ok := ctx.Value(spanKey{}).(byte); ok {
+		traceID[15] = v
+		spanID[7] = v
+		return traceID, spanID, true
+	}
+	return traceID, spanID, false
+}
+
+// decode protobuf message into field number -> values, varint and fixed64 values are decoded to uint64,
+// length-delimited values are kept as []byte
+func decodeProto(t *testing.T, data []byte) map[int][]interface{} {
+	var fields = map[int][]interface{}{}
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		data = data[n:]
+		fieldNum := int(tag >> 3)
+		switch tag & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(data)
+			data = data[n:]
+			fields[fieldNum] = append(fields[fieldNum], v)
+		case wireFixed64:
+			fields[fieldNum] = append(fields[fieldNum], binary.LittleEndian.Uint64(data))
+			data = data[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			data = data[n:]
+			fields[fieldNum] = append(fields[fieldNum], data[:l])
+			data = data[l:]
+		default:
+			t.Fatal("unexpected wire type")
+		}
+	}
+	return fields
+}
+
+func TestOTLPAppender_Protobuf(t *testing.T) {
+	recorder := &httpRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	appender := NewOTLPAppender(server.URL+"/v1/logs", OTLPProtobuf, F("service.name", "test-service"))
+	appender.SetTransformer(NewOTLPTransformer(OTLPProtobuf, testSpanContextExtractor))
+	logger := GetLogger("otlp_proto_test")
+	logger.SetAppenders(appender)
+	ctx := context.WithValue(context.Background(), spanKey{}, byte(7))
+	logger.Warn(ctx, "test message", F("count", 3))
+	assert.NoError(t, appender.Close())
+
+	bodies := recorder.received()
+	assert.Equal(t, 1, len(bodies))
+	assert.Equal(t, "application/x-protobuf", recorder.requests[0].Header.Get("Content-Type"))
+	request := decodeProto(t, []byte(bodies[0]))
+	resourceLogs := decodeProto(t, request[1][0].([]byte))
+	resource := decodeProto(t, resourceLogs[1][0].([]byte))
+	serviceName := decodeProto(t, resource[1][0].([]byte))
+	assert.Equal(t, "service.name", string(serviceName[1][0].([]byte)))
+
+	scopeLogs := decodeProto(t, resourceLogs[2][0].([]byte))
+	scope := decodeProto(t, scopeLogs[1][0].([]byte))
+	assert.Equal(t, "otlp_proto_test", string(scope[1][0].([]byte)))
+	record := decodeProto(t, scopeLogs[2][0].([]byte))
+	assert.Equal(t, uint64(13), record[2][0])
+	assert.Equal(t, "Warn", string(record[3][0].([]byte)))
+	body := decodeProto(t, record[5][0].([]byte))
+	assert.Equal(t, "test message", string(body[1][0].([]byte)))
+	assert.Equal(t, 4, len(record[6]))
+	count := decodeProto(t, record[6][0].([]byte))
+	assert.Equal(t, "count", string(count[1][0].([]byte)))
+	assert.Equal(t, uint64(3), decodeProto(t, count[2][0].([]byte))[3][0])
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 7}, record[9][0])
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 7}, record[10][0])
+}
+
+func TestOTLPAppender_JSON(t *testing.T) {
+	recorder := &httpRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	appender := NewOTLPAppender(server.URL+"/v1/logs", OTLPJSON)
+	appender.SetTransformer(NewOTLPTransformer(OTLPJSON, testSpanContextExtractor))
+	logger := GetLogger("otlp_json_test")
+	logger.SetAppenders(appender)
+	logger.Info("first", F("ok", true))
+	logger.ErrorFormat("second {}", 2, context.WithValue(context.Background(), spanKey{}, byte(255)))
+	assert.NoError(t, appender.Close())
+
+	bodies := recorder.received()
+	assert.Equal(t, 1, len(bodies))
+	var request struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []map[string]interface{}
+			}
+			ScopeLogs []struct {
+				Scope      map[string]string
+				LogRecords []map[string]interface{}
+			}
+		}
+	}
+	assert.NoError(t, json.Unmarshal([]byte(bodies[0]), &request))
+	resourceLogs := request.ResourceLogs[0]
+	assert.Equal(t, "service.name", resourceLogs.Resource.Attributes[0]["key"])
+	assert.Equal(t, "otlp_json_test", resourceLogs.ScopeLogs[0].Scope["name"])
+	records := resourceLogs.ScopeLogs[0].LogRecords
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, float64(9), records[0]["severityNumber"])
+	assert.Equal(t, map[string]interface{}{"stringValue": "first"}, records[0]["body"])
+	assert.Equal(t, map[string]interface{}{"key": "ok", "value": map[string]interface{}{"boolValue": true}},
+		records[0]["attributes"].([]interface{})[0])
+	assert.Nil(t, records[0]["traceId"])
+	assert.Equal(t, "Error", records[1]["severityText"])
+	assert.Equal(t, map[string]interface{}{"stringValue": "second 2"}, records[1]["body"])
+	assert.Equal(t, "000000000000000000000000000000ff", records[1]["traceId"])
+	assert.Equal(t, "00000000000000ff", records[1]["spanId"])
+}
+
+func TestOTLPTransformer_Error(t *testing.T) {
+	transformer := NewOTLPTransformer(OTLPJSON, nil)
+	event := transformer.Transform(LogRecord{Level: Error, Message: "failed", Fields: []Field{Err(errors.New("refused"))}})
+	var record struct {
+		Attributes []struct {
+			Key   string
+			Value map[string]interface{}
+		}
+	}
+	assert.NoError(t, json.Unmarshal(event.Message, &record))
+	assert.Equal(t, "exception.type", record.Attributes[0].Key)
+	assert.Equal(t, "*errors.errorString", record.Attributes[0].Value["stringValue"])
+	assert.Equal(t, "exception.message", record.Attributes[1].Key)
+	assert.Equal(t, "refused", record.Attributes[1].Value["stringValue"])
+}
@@ -0,0 +1,331 @@
+package vlog
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// stringFilter convert variable value in PatternTransformer
+type stringFilter func(value string) string
+
+// PatternFilterFunc is a custom filter for PatternTransformer, convert variable value.
+// arg is the filter argument after ':', for example, for {logger|myfilter:abc}, arg is "abc".
+type PatternFilterFunc func(value string, arg string) string
+
+var patternFilters = map[string]PatternFilterFunc{
+	"upper": func(value string, arg string) string {
+		return strings.ToUpper(value)
+	},
+	"lower": func(value string, arg string) string {
+		return strings.ToLower(value)
+	},
+	"trim": func(value string, arg string) string {
+		return strings.TrimSpace(value)
+	},
+	"json": func(value string, arg string) string {
+		data, _ := json.Marshal(value)
+		return string(data[1 : len(data)-1])
+	},
+	"default": func(value string, arg string) string {
+		if value == "" {
+			return arg
+		}
+		return value
+	},
+}
+var patternFiltersLock sync.RWMutex
+
+// RegisterPatternFilter register a custom filter, which can be used by all variables in PatternTransformer pattern,
+// as {variable|name} or {variable|name:arg}.
+// Filters should be registered before creating transformers using them.
+// RegisterPatternFilter panics if the name is empty, contains ':' or '|', or is already registered.
+func RegisterPatternFilter(name string, filter PatternFilterFunc) {
+	if name == "" || strings.ContainsAny(name, ":|{}") || name == "abbr" {
+		panic("vlog: invalid pattern filter name: " + name)
+	}
+	if filter == nil {
+		panic("vlog: pattern filter is nil: " + name)
+	}
+	patternFiltersLock.Lock()
+	defer patternFiltersLock.Unlock()
+	if _, ok := patternFilters[name]; ok {
+		panic("vlog: pattern filter already registered: " + name)
+	}
+	patternFilters[name] = filter
+}
+
+// parse filter str, like "-5" or "abbr|20.20", and set to item
+func setFilters(item *patternItem, filterStr string) error {
+	specs := strings.Split(filterStr, "|")
+	if item.kind == timestamp {
+		// the first one is the time layout
+		item.layout = specs[0]
+		if layout, ok := timeLayouts[specs[0]]; ok {
+			item.layout = layout
+		}
+		specs = specs[1:]
+	}
+	for _, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		filter, err := parseFilter(spec)
+		if err != nil && item.kind == timestamp && item.location == nil {
+			// time zone option for time
+			location, locationErr := time.LoadLocation(spec)
+			if locationErr == nil {
+				item.location = location
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		item.filters = append(item.filters, filter)
+	}
+	if len(item.filters) == 1 && len(specs) == 1 {
+		// single width filter is applied on bytes directly, to avoid allocation
+		if width, ok := parseWidth(specs[0]); ok {
+			item.width = width
+			item.filters = nil
+		}
+	}
+	return nil
+}
+
+// time layout shorthands for {time}, and epoch formats
+var timeLayouts = map[string]string{
+	"RFC3339":      time.RFC3339,
+	"RFC3339Nano":  time.RFC3339Nano,
+	"RFC3339Milli": "2006-01-02T15:04:05.000Z07:00",
+	"RFC1123":      time.RFC1123,
+	"RFC1123Z":     time.RFC1123Z,
+	"unix":         epochSeconds,
+	"unixmilli":    epochMillis,
+	"unixmicro":    epochMicros,
+	"unixnano":     epochNanos,
+}
+
+// special layouts for epoch time
+const (
+	epochSeconds = "\x00unix"
+	epochMillis  = "\x00unixmilli"
+	epochMicros  = "\x00unixmicro"
+	epochNanos   = "\x00unixnano"
+)
+
+// append formatted time for {time} variable to buf
+func appendTime(buf []byte, t time.Time, layout string, location *time.Location) []byte {
+	switch layout {
+	case epochSeconds:
+		return strconv.AppendInt(buf, t.Unix(), 10)
+	case epochMillis:
+		return strconv.AppendInt(buf, t.UnixNano()/int64(time.Millisecond), 10)
+	case epochMicros:
+		return strconv.AppendInt(buf, t.UnixNano()/int64(time.Microsecond), 10)
+	case epochNanos:
+		return strconv.AppendInt(buf, t.UnixNano(), 10)
+	}
+	if location == nil {
+		location = DefaultTimeZone()
+	}
+	if location != nil {
+		t = t.In(location)
+	}
+	if layout == "" {
+		layout = "2006-01-02 15:04:05.000"
+	}
+	return t.AppendFormat(buf, layout)
+}
+
+var defaultTimeZone atomic.Value // *time.Location
+
+// SetDefaultTimeZone set the default time zone used to format time, by PatternTransformer {time} variable without
+// explicit time zone, and by JSONTransformer. Set nil to not convert the log time, which is in local time zone.
+func SetDefaultTimeZone(location *time.Location) {
+	defaultTimeZone.Store(&location)
+}
+
+// DefaultTimeZone return the default time zone used to format time, nil means the log time is not converted.
+func DefaultTimeZone() *time.Location {
+	if v := defaultTimeZone.Load(); v != nil {
+		return *v.(**time.Location)
+	}
+	return nil
+}
+
+func parseFilter(spec string) (stringFilter, error) {
+	if spec == "abbr" {
+		return func(value string) string {
+			return abbreviate(value, 0)
+		}, nil
+	}
+	if strings.HasPrefix(spec, "abbr:") {
+		maxLen, err := strconv.Atoi(spec[len("abbr:"):])
+		if err != nil {
+			return nil, errors.New("invalid abbr filter: " + spec)
+		}
+		return func(value string) string {
+			return abbreviate(value, maxLen)
+		}, nil
+	}
+	if filter, ok := parseWidthFilter(spec); ok {
+		return filter, nil
+	}
+
+	name, arg := spec, ""
+	if idx := strings.IndexByte(spec, ':'); idx >= 0 {
+		name, arg = spec[:idx], spec[idx+1:]
+	}
+	patternFiltersLock.RLock()
+	filter, ok := patternFilters[name]
+	patternFiltersLock.RUnlock()
+	if !ok {
+		return nil, errors.New("unknown filter: " + spec)
+	}
+	return func(value string) string {
+		return filter(value, arg)
+	}, nil
+}
+
+// parse width spec like logback: [-]min[.[-]max] or .[-]max
+func parseWidthFilter(spec string) (stringFilter, bool) {
+	width, ok := parseWidth(spec)
+	if !ok {
+		return nil, false
+	}
+	return width.filter, true
+}
+
+// widthSpec is the parsed width filter
+type widthSpec struct {
+	minWidth    int
+	maxWidth    int
+	leftJustify bool
+	truncateEnd bool
+}
+
+func parseWidth(spec string) (*widthSpec, bool) {
+	var minStr = spec
+	var maxStr = ""
+	if idx := strings.IndexByte(spec, '.'); idx >= 0 {
+		minStr, maxStr = spec[:idx], spec[idx+1:]
+	}
+
+	var width = &widthSpec{}
+	if minStr != "" {
+		if minStr[0] == '-' {
+			width.leftJustify = true
+			minStr = minStr[1:]
+		}
+		v, err := strconv.ParseUint(minStr, 10, 31)
+		if err != nil {
+			return nil, false
+		}
+		width.minWidth = int(v)
+	}
+
+	if maxStr != "" {
+		if maxStr[0] == '-' {
+			width.truncateEnd = true
+			maxStr = maxStr[1:]
+		}
+		v, err := strconv.ParseUint(maxStr, 10, 31)
+		if err != nil || v == 0 {
+			return nil, false
+		}
+		width.maxWidth = int(v)
+	} else if strings.IndexByte(spec, '.') >= 0 {
+		return nil, false
+	}
+	return width, true
+}
+
+func (w *widthSpec) filter(value string) string {
+	width := utf8.RuneCountInString(value)
+	if w.maxWidth > 0 && width > w.maxWidth {
+		runes := []rune(value)
+		if w.truncateEnd {
+			return string(runes[:w.maxWidth])
+		}
+		return string(runes[width-w.maxWidth:])
+	}
+	if width < w.minWidth {
+		padding := strings.Repeat(" ", w.minWidth-width)
+		if w.leftJustify {
+			return value + padding
+		}
+		return padding + value
+	}
+	return value
+}
+
+// apply width to value buf[start:] in place, return the result buf
+func (w *widthSpec) apply(buf []byte, start int) []byte {
+	width := utf8.RuneCount(buf[start:])
+	if w.maxWidth > 0 && width > w.maxWidth {
+		if w.truncateEnd {
+			return buf[:skipRunes(buf, start, w.maxWidth)]
+		}
+		return append(buf[:start], buf[skipRunes(buf, start, width-w.maxWidth):]...)
+	}
+	if width < w.minWidth {
+		padding := w.minWidth - width
+		end := len(buf)
+		for idx := 0; idx < padding; idx++ {
+			buf = append(buf, ' ')
+		}
+		if !w.leftJustify {
+			copy(buf[start+padding:], buf[start:end])
+			for idx := start; idx < start+padding; idx++ {
+				buf[idx] = ' '
+			}
+		}
+	}
+	return buf
+}
+
+// return the index after skipping n runes from start
+func skipRunes(buf []byte, start int, n int) int {
+	idx := start
+	for ; n > 0; n-- {
+		_, size := utf8.DecodeRune(buf[idx:])
+		idx += size
+	}
+	return idx
+}
+
+// abbreviate path like names, split by '/' and '.', to first char of segments except the last one.
+// If maxLen > 0, only abbreviate segments from left, until the length of result not larger than maxLen.
+func abbreviate(name string, maxLen int) string {
+	if maxLen > 0 && len(name) <= maxLen {
+		return name
+	}
+	segments := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '/' || r == '.'
+	})
+	if len(segments) <= 1 {
+		return name
+	}
+
+	// length when joined by '.'
+	var length = len(segments) - 1
+	for _, segment := range segments {
+		length += len(segment)
+	}
+	for idx := 0; idx < len(segments)-1; idx++ {
+		if maxLen > 0 && length <= maxLen {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(segments[idx])
+		length -= len(segments[idx]) - size
+		segments[idx] = segments[idx][:size]
+	}
+	return strings.Join(segments, ".")
+}
@@ -0,0 +1,122 @@
+package vlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWidthFilter(t *testing.T) {
+	filter, ok := parseWidthFilter("-5")
+	assert.True(t, ok)
+	assert.Equal(t, "Info ", filter("Info"))
+	assert.Equal(t, "Critical", filter("Critical"))
+
+	filter, _ = parseWidthFilter("5")
+	assert.Equal(t, " Info", filter("Info"))
+
+	filter, _ = parseWidthFilter("6.6")
+	assert.Equal(t, "   abc", filter("abc"))
+	assert.Equal(t, "efghij", filter("abcdefghij"))
+
+	filter, _ = parseWidthFilter(".-3")
+	assert.Equal(t, "abc", filter("abcdefghij"))
+	assert.Equal(t, "日本語", filter("日本語です"))
+
+	_, ok = parseWidthFilter("abc")
+	assert.False(t, ok)
+	_, ok = parseWidthFilter("5.")
+	assert.False(t, ok)
+}
+
+func TestAbbreviate(t *testing.T) {
+	assert.Equal(t, "g.c.h.vlog", abbreviate("github.com/hsiafan/vlog", 0))
+	assert.Equal(t, "github.com/hsiafan/vlog", abbreviate("github.com/hsiafan/vlog", 30))
+	assert.Equal(t, "g.c.hsiafan.vlog", abbreviate("github.com/hsiafan/vlog", 16))
+	assert.Equal(t, "g.c.h.vlog", abbreviate("github.com/hsiafan/vlog", 5))
+	assert.Equal(t, "main", abbreviate("main", 0))
+}
+
+func TestPatternTransformer_Filters(t *testing.T) {
+	transformer, err := NewPatternTransformer("[{Level|-5}] {logger|abbr|12} {time|15:04|-6}|")
+	assert.NoError(t, err)
+	ts := time.Date(2019, 1, 1, 10, 20, 0, 0, time.Local)
+	event := transformer.Transform(LogRecord{LoggerName: "github.com/user/pkg", Level: Info, LogTime: ts})
+	assert.Equal(t, "[Info ]    g.c.u.pkg 10:20 |", string(event.Message))
+
+	_, err = NewPatternTransformer("{logger|unknown}")
+	assert.Error(t, err)
+}
+
+func TestPatternTransformer_BuiltinFilters(t *testing.T) {
+	transformer, err := NewPatternTransformer(`{logger|upper} {Level|lower} "{message|trim|json}" {field:user|default:-}`)
+	assert.NoError(t, err)
+	event := transformer.Transform(LogRecord{LoggerName: "svc", Level: Warn, Message: " say \"hi\"\n"})
+	assert.Equal(t, `SVC warn "say \"hi\"" -`, string(event.Message))
+}
+
+func TestRegisterPatternFilterAndVariable(t *testing.T) {
+	RegisterPatternFilter("test_repeat", func(value string, arg string) string {
+		return value + arg + value
+	})
+	RegisterPatternVariable("test_tenant", func(record *LogRecord, arg string, buf *[]byte) {
+		for _, field := range record.Fields {
+			if field.Key == "tenant" {
+				*buf = append(*buf, fieldText(field.Value)...)
+				return
+			}
+		}
+		*buf = append(*buf, arg...)
+	})
+	assert.Panics(t, func() {
+		RegisterPatternFilter("test_repeat", func(value string, arg string) string { return value })
+	})
+	assert.Panics(t, func() {
+		RegisterPatternVariable("logger", func(record *LogRecord, arg string, buf *[]byte) {})
+	})
+
+	transformer, err := NewPatternTransformer("{test_tenant:none|-6}|{message|test_repeat:-}")
+	assert.NoError(t, err)
+	event := transformer.Transform(LogRecord{Message: "m", Fields: []Field{F("tenant", "t1")}})
+	assert.Equal(t, "t1    |m-m", string(event.Message))
+	event = transformer.Transform(LogRecord{Message: "m"})
+	assert.Equal(t, "none  |m-m", string(event.Message))
+
+	_, err = NewPatternTransformer("{test_unknown}")
+	assert.Error(t, err)
+}
+
+func TestPatternTransformer_TimeOptions(t *testing.T) {
+	ts := time.Date(2019, 10, 1, 12, 30, 0, 123456789, time.FixedZone("X", 8*3600))
+	record := LogRecord{LogTime: ts}
+
+	transformer := MustNewPatternTransformer("{time|2006-01-02T15:04:05Z07:00|UTC}")
+	assert.Equal(t, "2019-10-01T04:30:00Z", string(transformer.Transform(record).Message))
+	transformer = MustNewPatternTransformer("{time|RFC3339Nano|America/New_York}")
+	assert.Equal(t, "2019-10-01T00:30:00.123456789-04:00", string(transformer.Transform(record).Message))
+	transformer = MustNewPatternTransformer("{time|unix} {time|unixmilli} {time|unixnano|-20}|")
+	assert.Equal(t, "1569904200 1569904200123 1569904200123456789 |", string(transformer.Transform(record).Message))
+
+	_, err := NewPatternTransformer("{time|RFC3339|Not/AZone}")
+	assert.Error(t, err)
+
+	defer SetDefaultTimeZone(nil)
+	SetDefaultTimeZone(time.UTC)
+	transformer = MustNewPatternTransformer("{time|RFC3339}")
+	assert.Equal(t, "2019-10-01T04:30:00Z", string(transformer.Transform(record).Message))
+	SetDefaultTimeZone(nil)
+	assert.Equal(t, "2019-10-01T12:30:00+08:00", string(transformer.Transform(record).Message))
+}
+
+func TestWidthSpec_Apply(t *testing.T) {
+	for _, spec := range []string{"-5", "5", "6.6", ".-3", "2.4", "-8.-2"} {
+		width, ok := parseWidth(spec)
+		assert.True(t, ok)
+		for _, value := range []string{"", "abc", "Info", "abcdefghij", "日本語です"} {
+			buf := []byte("prefix|")
+			buf = append(buf, value...)
+			assert.Equal(t, "prefix|"+width.filter(value), string(width.apply(buf, len("prefix|"))), spec+" "+value)
+		}
+	}
+}
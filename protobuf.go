@@ -0,0 +1,55 @@
+package vlog
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// minimal protobuf encoding helpers, for appenders sending protobuf messages without depending on protobuf libs
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendProtoVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendProtoTag(buf []byte, fieldNum int, wireType int) []byte {
+	return appendProtoVarint(buf, uint64(fieldNum)<<3|uint64(wireType))
+}
+
+func appendProtoVarintField(buf []byte, fieldNum int, v uint64) []byte {
+	buf = appendProtoTag(buf, fieldNum, wireVarint)
+	return appendProtoVarint(buf, v)
+}
+
+func appendProtoFixed64Field(buf []byte, fieldNum int, v uint64) []byte {
+	buf = appendProtoTag(buf, fieldNum, wireFixed64)
+	var data [8]byte
+	binary.LittleEndian.PutUint64(data[:], v)
+	return append(buf, data[:]...)
+}
+
+func appendProtoDoubleField(buf []byte, fieldNum int, v float64) []byte {
+	return appendProtoFixed64Field(buf, fieldNum, math.Float64bits(v))
+}
+
+// append a length-delimited field, for string, bytes, and embedded messages
+func appendProtoBytesField(buf []byte, fieldNum int, data []byte) []byte {
+	buf = appendProtoTag(buf, fieldNum, wireBytes)
+	buf = appendProtoVarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func appendProtoStringField(buf []byte, fieldNum int, str string) []byte {
+	buf = appendProtoTag(buf, fieldNum, wireBytes)
+	buf = appendProtoVarint(buf, uint64(len(str)))
+	return append(buf, str...)
+}
@@ -0,0 +1,94 @@
+package vlog
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// the runtime.Callers skip to get the stack of panic, when called in logPanic:
+// runtime.Callers, logPanic, and the recovering method are skipped, the stack starts from the panic call.
+const panicStackSkip = 3
+
+// panicError wrap the panic value which is not an error
+type panicError struct {
+	value interface{}
+}
+
+func (p *panicError) Error() string {
+	return fmt.Sprint(p.value)
+}
+
+// RecoverAndLog recover panic, log the panic value with stack trace at Critical level,
+// then flush all appenders by FlushAppenders. The panic is not propagated.
+// It should be deferred directly:
+//
+//	defer logger.RecoverAndLog()
+func (l *Logger) RecoverAndLog() {
+	if value := recover(); value != nil {
+		l.logPanic(value)
+		flushAfterPanic()
+	}
+}
+
+// RecoverAndRepanic do as RecoverAndLog, then panic again with the recovered value.
+// It should be deferred directly:
+//
+//	defer logger.RecoverAndRepanic()
+func (l *Logger) RecoverAndRepanic() {
+	if value := recover(); value != nil {
+		l.logPanic(value)
+		flushAfterPanic()
+		panic(value)
+	}
+}
+
+// Go run f in a new goroutine. Panics in f are recovered and logged by logger, see Logger.RecoverAndLog.
+func Go(logger *Logger, f func()) {
+	go func() {
+		defer logger.RecoverAndLog()
+		f()
+	}()
+}
+
+// log the panic value with an error field with stack trace, at Critical level. Should be called directly in
+// recovering methods. The caller of record is the code that panicked, not the runtime panic frames.
+func (l *Logger) logPanic(value interface{}) {
+	appenders := l.Appenders()
+	if l.Level() > Critical || len(appenders) == 0 {
+		return
+	}
+	err, ok := value.(error)
+	if !ok {
+		err = &panicError{value: value}
+	}
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(panicStackSkip, pcs[:])
+	stack := append([]uintptr(nil), pcs[:n]...)
+	record := LogRecord{
+		Level:    Critical,
+		Message:  joinMessage("panic recovered:", value),
+		Fields:   []Field{F("error", &errorValue{err: err, stack: stack})},
+		callerPC: panicCallerPC(stack),
+	}
+	if err := l.writeToAppends(appenders, record); err != nil {
+		reportError("log error", err)
+	}
+}
+
+// the first program counter in panic stack not in runtime package, or 0 if not found
+func panicCallerPC(stack []uintptr) uintptr {
+	for _, pc := range stack {
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			return pc
+		}
+	}
+	return 0
+}
+
+func flushAfterPanic() {
+	if err := FlushAppenders(); err != nil {
+		reportError("flush appenders error", err)
+	}
+}
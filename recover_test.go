@@ -0,0 +1,112 @@
+package vlog
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// appender send messages to channel, for testing logs from other goroutines
+type chanAppender struct {
+	*CanFormattedMixin
+	ch chan string
+}
+
+func (c *chanAppender) Append(event AppendEvent) error {
+	c.ch <- string(event.Message)
+	return nil
+}
+
+func TestLogger_RecoverAndLog(t *testing.T) {
+	appender := NewBytesAppender()
+	appender.SetTransformer(MustNewPatternTransformer("{Level} {message} {error}\n{stack}\n"))
+	logger := GetLogger("vlog/test/recover")
+	logger.SetAppenders(appender)
+
+	assert.NotPanics(t, func() {
+		defer logger.RecoverAndLog()
+		panic("boom")
+	})
+	output := appender.buffer.String()
+	assert.True(t, strings.HasPrefix(output, "Critical panic recovered: boom boom (*vlog.panicError)\n"), output)
+	assert.Contains(t, output, "vlog.TestLogger_RecoverAndLog")
+	assert.Contains(t, output, "recover_test.go:")
+
+	assert.PanicsWithValue(t, "boom", func() {
+		defer logger.RecoverAndRepanic()
+		panic("boom")
+	})
+}
+
+func TestLogger_RecoverAndLogCaller(t *testing.T) {
+	appender := NewBytesAppender()
+	appender.SetTransformer(MustNewPatternTransformer("{file} {function}\n"))
+	logger := GetLogger("vlog/test/recover/caller")
+	logger.SetAppenders(appender)
+
+	func() {
+		defer logger.RecoverAndLog()
+		panic("boom")
+	}()
+	func() {
+		defer logger.RecoverAndLog()
+		var m map[string]int
+		m["a"] = 1
+	}()
+	assert.Equal(t, "recover_test.go func1\n"+
+		"recover_test.go func2\n", appender.buffer.String())
+}
+
+func TestGo(t *testing.T) {
+	appender := &chanAppender{CanFormattedMixin: NewAppenderMixin(), ch: make(chan string, 1)}
+	appender.SetTransformer(MustNewPatternTransformer("{message}"))
+	logger := GetLogger("vlog/test/go")
+	logger.SetAppenders(appender)
+
+	Go(logger, func() {
+		var m map[string]int
+		m["a"] = 1
+	})
+	select {
+	case message := <-appender.ch:
+		assert.Equal(t, "panic recovered: assignment to entry in nil map", message)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "panic not logged")
+	}
+}
+
+func TestFileAppender_RedirectStderr(t *testing.T) {
+	if path := os.Getenv("VLOG_TEST_STDERR_PATH"); path != "" {
+		// in sub process, crash with stderr redirected
+		appender, err := NewFileAppender(path, nil)
+		if err != nil {
+			os.Exit(3)
+		}
+		if err = appender.RedirectStderr(); err != nil {
+			os.Exit(4)
+		}
+		panic("crash in sub process")
+	}
+
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("redirect stderr is not supported")
+	}
+	dir, _ := ioutil.TempDir("", "vlog")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stderr.log")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFileAppender_RedirectStderr$")
+	cmd.Env = append(os.Environ(), "VLOG_TEST_STDERR_PATH="+path)
+	err := cmd.Run()
+	exitErr, ok := err.(*exec.ExitError)
+	if assert.True(t, ok, "%v", err) {
+		assert.Equal(t, 2, exitErr.ExitCode())
+	}
+	assert.Contains(t, readFile(t, path), "panic: crash in sub process")
+}
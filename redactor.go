@@ -0,0 +1,260 @@
+package vlog
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Redactable can be implemented by types holding secrets, to provide safe string forms for logging.
+// When passed as log args or field values, the Redacted value is logged instead.
+type Redactable interface {
+	// Redacted return the string form safe for logging
+	Redacted() string
+}
+
+// MaskFunc return the masked value of sensitive text
+type MaskFunc func(value string) string
+
+// MaskAll replace the whole value with "****"
+func MaskAll(value string) string {
+	return "****"
+}
+
+// MaskKeepLast return a MaskFunc, keep the last n chars, and replace others with "****", like ****1234.
+// If value has no more than 2*n chars, the whole value is replaced.
+func MaskKeepLast(n int) MaskFunc {
+	return func(value string) string {
+		if len(value) <= 2*n {
+			return "****"
+		}
+		return "****" + value[len(value)-n:]
+	}
+}
+
+var (
+	creditCardPattern   = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	emailPattern        = regexp.MustCompile(`\b([A-Za-z0-9._%+\-]+)@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}\b`)
+	bearerTokenPattern  = regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`)
+	awsAccessKeyPattern = regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`)
+)
+
+// default sensitive field names, used by NewDefaultRedactor
+var defaultRedactFieldNames = []string{"password", "passwd", "secret", "token", "authorization", "api_key",
+	"apikey", "access_token", "refresh_token", "cookie", "aws_secret_access_key"}
+
+// Redactor remove secrets and PII from log records, before records are transformed by transformers.
+// Text matching regex rules are masked, in message, string field values and error strings;
+// values of fields with sensitive names are masked entirely. Set by SetRedactor, applied to all loggers.
+type Redactor struct {
+	rules      []redactRule
+	fieldNames map[string]bool // lower case
+	fieldMask  MaskFunc
+}
+
+type redactRule struct {
+	pattern *regexp.Regexp
+	mask    MaskFunc
+	valid   func(match string) bool // nil means all matches are valid
+}
+
+// NewRedactor create a Redactor without rules
+func NewRedactor() *Redactor {
+	return &Redactor{fieldNames: map[string]bool{}, fieldMask: MaskAll}
+}
+
+// NewDefaultRedactor create a Redactor with all builtin rules: credit cards, emails, bearer tokens, aws access keys,
+// and sensitive field names such as password, token and authorization.
+func NewDefaultRedactor() *Redactor {
+	r := NewRedactor()
+	r.AddCreditCards()
+	r.AddEmails()
+	r.AddBearerTokens()
+	r.AddAWSAccessKeys()
+	r.AddFieldNames(defaultRedactFieldNames...)
+	return r
+}
+
+// AddPattern add a regex rule. If pattern has capturing groups, only the text of first group is masked,
+// otherwise the whole matched text is masked.
+// This method should be called before redactor start to work.
+func (r *Redactor) AddPattern(pattern *regexp.Regexp, mask MaskFunc) {
+	r.rules = append(r.rules, redactRule{pattern: pattern, mask: mask})
+}
+
+// AddCreditCards add rule masking credit card numbers passed luhn check, keep the last 4 digits.
+// This method should be called before redactor start to work.
+func (r *Redactor) AddCreditCards() {
+	r.rules = append(r.rules, redactRule{pattern: creditCardPattern, mask: MaskKeepLast(4), valid: luhnValid})
+}
+
+// AddEmails add rule masking the local part of email addresses, like ****@example.com.
+// This method should be called before redactor start to work.
+func (r *Redactor) AddEmails() {
+	r.AddPattern(emailPattern, MaskAll)
+}
+
+// AddBearerTokens add rule masking bearer tokens, like "Bearer ****".
+// This method should be called before redactor start to work.
+func (r *Redactor) AddBearerTokens() {
+	r.AddPattern(bearerTokenPattern, MaskAll)
+}
+
+// AddAWSAccessKeys add rule masking aws access key ids, keep the last 4 chars.
+// This method should be called before redactor start to work.
+func (r *Redactor) AddAWSAccessKeys() {
+	r.AddPattern(awsAccessKeyPattern, MaskKeepLast(4))
+}
+
+// AddFieldNames add sensitive field names, values of these fields are masked entirely. Names are case-insensitive.
+// This method should be called before redactor start to work.
+func (r *Redactor) AddFieldNames(names ...string) {
+	for _, name := range names {
+		r.fieldNames[strings.ToLower(name)] = true
+	}
+}
+
+// SetFieldMask set the mask for values of sensitive fields, default is MaskAll.
+// This method should be called before redactor start to work.
+func (r *Redactor) SetFieldMask(mask MaskFunc) {
+	r.fieldMask = mask
+}
+
+// Redact mask the sensitive text in str by regex rules
+func (r *Redactor) Redact(str string) string {
+	for _, rule := range r.rules {
+		str = rule.apply(str)
+	}
+	return str
+}
+
+func (rule *redactRule) apply(str string) string {
+	matches := rule.pattern.FindAllStringSubmatchIndex(str, -1)
+	if len(matches) == 0 {
+		return str
+	}
+	var sb strings.Builder
+	last := 0
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if len(match) >= 4 && match[2] >= 0 {
+			start, end = match[2], match[3]
+		}
+		if rule.valid != nil && !rule.valid(str[start:end]) {
+			continue
+		}
+		sb.WriteString(str[last:start])
+		sb.WriteString(rule.mask(str[start:end]))
+		last = end
+	}
+	sb.WriteString(str[last:])
+	return sb.String()
+}
+
+// redact the message and fields of record. The fields slice is copied if modified.
+func (r *Redactor) redactRecord(record LogRecord) LogRecord {
+	record.Message = r.Redact(record.Message)
+	var fields []Field
+	for idx, field := range record.Fields {
+		value, changed := r.redactValue(field.Key, field.Value)
+		if !changed {
+			continue
+		}
+		if fields == nil {
+			fields = append([]Field(nil), record.Fields...)
+		}
+		fields[idx].Value = value
+	}
+	if fields != nil {
+		record.Fields = fields
+	}
+	return record
+}
+
+// return the redacted value, and if the value is changed
+func (r *Redactor) redactValue(key string, value interface{}) (interface{}, bool) {
+	if value == nil {
+		return value, false
+	}
+	if r.fieldNames[strings.ToLower(key)] {
+		return r.fieldMask(fieldText(value)), true
+	}
+	switch v := value.(type) {
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64,
+		time.Time, time.Duration, Redactable:
+		return value, false
+	case string:
+		redacted := r.Redact(v)
+		return redacted, redacted != v
+	case *errorValue:
+		return &errorValue{err: r.redactError(v.err), stack: v.stack}, true
+	case error:
+		return r.Redact(v.Error()), true
+	default:
+		text := fieldText(v)
+		if redacted := r.Redact(text); redacted != text {
+			return redacted, true
+		}
+		return value, false
+	}
+}
+
+// redactedError is error with message redacted, keeping the type and causes of origin error
+type redactedError struct {
+	err     error
+	message string
+	cause   error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.cause
+}
+
+func (r *Redactor) redactError(err error) error {
+	redacted := &redactedError{err: err, message: r.Redact(err.Error())}
+	if cause := errors.Unwrap(err); cause != nil {
+		redacted.cause = r.redactError(cause)
+	}
+	return redacted
+}
+
+// luhn checksum check for credit card numbers, spaces and dashes are ignored
+func luhnValid(number string) bool {
+	sum := 0
+	digits := 0
+	for idx := len(number) - 1; idx >= 0; idx-- {
+		c := number[idx]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+var redactor unsafe.Pointer // *Redactor
+
+// SetRedactor set the redactor applied to records of all loggers, before records are transformed.
+// Set nil to disable redaction, which is the default.
+func SetRedactor(r *Redactor) {
+	atomic.StorePointer(&redactor, unsafe.Pointer(r))
+}
+
+func currentRedactor() *Redactor {
+	return (*Redactor)(atomic.LoadPointer(&redactor))
+}
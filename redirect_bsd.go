@@ -0,0 +1,14 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+// +build darwin freebsd netbsd openbsd dragonfly
+
+package vlog
+
+import (
+	"os"
+	"syscall"
+)
+
+// redirectStderr make the stderr fd of process refer to file
+func redirectStderr(file *os.File) error {
+	return syscall.Dup2(int(file.Fd()), int(os.Stderr.Fd()))
+}
@@ -0,0 +1,14 @@
+//go:build linux
+// +build linux
+
+package vlog
+
+import (
+	"os"
+	"syscall"
+)
+
+// redirectStderr make the stderr fd of process refer to file
+func redirectStderr(file *os.File) error {
+	return syscall.Dup3(int(file.Fd()), int(os.Stderr.Fd()), 0)
+}
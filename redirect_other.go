@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package vlog
+
+import (
+	"errors"
+	"os"
+)
+
+// redirectStderr is not supported on these platforms
+func redirectStderr(file *os.File) error {
+	return errors.New("redirect stderr is not supported on this platform")
+}
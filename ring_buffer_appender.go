@@ -0,0 +1,116 @@
+package vlog
+
+import (
+	"sync"
+)
+
+var _ Appender = (*RingBufferAppender)(nil)
+
+// RingBufferAppender keep the last N log events, or last N bytes of log events, in memory.
+// The buffered events can be dumped to target appender on demand, or automatically when an event with level at or
+// above trigger level arrives, so detail logs around failures are kept without writing all of them to disk.
+// Events with level at or above pass level are written to target directly, and not buffered.
+//
+// For example, set logger level to Debug, and use a RingBufferAppender with file appender as target,
+// pass level Info and trigger level Error: Info and Warn logs are written to file as usual, the last Debug logs
+// are written to file only when Error happens.
+//
+// The events are transformed by the transformer of RingBufferAppender, not the target's.
+type RingBufferAppender struct {
+	*CanFormattedMixin
+	target       Appender
+	capacity     int
+	maxBytes     int
+	triggerLevel Level
+	passLevel    Level
+	lock         sync.Mutex
+	events       []AppendEvent
+	bytes        int
+}
+
+// NewRingBufferAppender create ring buffer appender, keep at most capacity events, and at most maxBytes message bytes.
+// zero or negative capacity/maxBytes means no limit for this dimension, but at least one should be set.
+// target is the appender buffered events are dumped to, can be nil if only use DumpTo.
+// The trigger level and pass level are Off by default, which means no automatic dump, and no events passed.
+func NewRingBufferAppender(target Appender, capacity int, maxBytes int) *RingBufferAppender {
+	return &RingBufferAppender{
+		CanFormattedMixin: NewAppenderMixin(),
+		target:            target,
+		capacity:          capacity,
+		maxBytes:          maxBytes,
+		triggerLevel:      Off,
+		passLevel:         Off,
+	}
+}
+
+// SetTriggerLevel set the level to dump buffered events automatically.
+// When an event at or above this level arrives, buffered events and the event itself are written to target.
+// This method should be called before appender start to work.
+func (r *RingBufferAppender) SetTriggerLevel(level Level) {
+	r.triggerLevel = level
+}
+
+// SetPassLevel set the level of events written to target directly, without buffering.
+// This method should be called before appender start to work.
+func (r *RingBufferAppender) SetPassLevel(level Level) {
+	r.passLevel = level
+}
+
+// Append buffer the event, or write to target by level
+func (r *RingBufferAppender) Append(event AppendEvent) error {
+	if r.target != nil && event.Level >= r.triggerLevel {
+		if err := r.Dump(); err != nil {
+			return err
+		}
+		return r.target.Append(event)
+	}
+	if r.target != nil && event.Level >= r.passLevel {
+		return r.target.Append(event)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event.Clone())
+	r.bytes += len(event.Message)
+	for len(r.events) > 1 && ((r.capacity > 0 && len(r.events) > r.capacity) || (r.maxBytes > 0 && r.bytes > r.maxBytes)) {
+		r.bytes -= len(r.events[0].Message)
+		r.events[0] = AppendEvent{}
+		r.events = r.events[1:]
+	}
+	return nil
+}
+
+// Events return a copy of buffered events, the oldest first
+func (r *RingBufferAppender) Events() []AppendEvent {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]AppendEvent(nil), r.events...)
+}
+
+// Dump write buffered events to target appender, and clear the buffer
+func (r *RingBufferAppender) Dump() error {
+	if r.target == nil {
+		return nil
+	}
+	return r.DumpTo(r.target)
+}
+
+// DumpTo write buffered events to appender, and clear the buffer
+func (r *RingBufferAppender) DumpTo(appender Appender) error {
+	r.lock.Lock()
+	events := r.events
+	r.events = nil
+	r.bytes = 0
+	r.lock.Unlock()
+
+	for _, event := range events {
+		if err := appender.Append(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RingBufferAppender) wrappedAppender() Appender {
+	return r.target
+}
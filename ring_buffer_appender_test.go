@@ -0,0 +1,65 @@
+package vlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ringBufferMessages(events []AppendEvent) []string {
+	var messages []string
+	for _, event := range events {
+		messages = append(messages, string(event.Message))
+	}
+	return messages
+}
+
+func TestRingBufferAppender_Capacity(t *testing.T) {
+	appender := NewRingBufferAppender(nil, 3, 0)
+	for _, message := range []string{"1", "2", "3", "4", "5"} {
+		assert.NoError(t, appender.Append(AppendEvent{Level: Debug, Message: []byte(message)}))
+	}
+	assert.Equal(t, []string{"3", "4", "5"}, ringBufferMessages(appender.Events()))
+
+	appender = NewRingBufferAppender(nil, 0, 5)
+	for _, message := range []string{"12", "34", "56", "7890123"} {
+		assert.NoError(t, appender.Append(AppendEvent{Level: Debug, Message: []byte(message)}))
+		if message == "56" {
+			assert.Equal(t, []string{"34", "56"}, ringBufferMessages(appender.Events()))
+		}
+	}
+	// always keep the last event
+	assert.Equal(t, []string{"7890123"}, ringBufferMessages(appender.Events()))
+}
+
+func TestRingBufferAppender_Trigger(t *testing.T) {
+	target := NewBytesAppender()
+	appender := NewRingBufferAppender(target, 2, 0)
+	appender.SetPassLevel(Info)
+	appender.SetTriggerLevel(Error)
+	appender.SetTransformer(MustNewPatternTransformer("{level}:{message}\n"))
+	logger := GetLogger("ring_buffer_test")
+	logger.SetLevel(Debug)
+	logger.SetAppenders(appender)
+
+	logger.Debug("debug1")
+	logger.Debug("debug2")
+	logger.Info("info")
+	logger.Debug("debug3")
+	assert.Equal(t, "info:info\n", target.buffer.String())
+
+	logger.Error("error")
+	assert.Equal(t, "info:info\ndebug:debug2\ndebug:debug3\nerror:error\n", target.buffer.String())
+	assert.Equal(t, 0, len(appender.Events()))
+}
+
+func TestRingBufferAppender_DumpTo(t *testing.T) {
+	appender := NewRingBufferAppender(nil, 10, 0)
+	assert.NoError(t, appender.Append(AppendEvent{Level: Error, Message: []byte("1\n")}))
+	assert.NoError(t, appender.Append(AppendEvent{Level: Trace, Message: []byte("2\n")}))
+
+	target := NewBytesAppender()
+	assert.NoError(t, appender.DumpTo(target))
+	assert.Equal(t, "1\n2\n", target.buffer.String())
+	assert.Equal(t, 0, len(appender.Events()))
+}
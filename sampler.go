@@ -0,0 +1,188 @@
+package vlog
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// the runtime.Callers skip of user code calling logger methods, when called directly in Sampler.allow
+const sampleCallerSkip = 4
+
+// Sampler limit the records of noisy log statements. For each log statement, identified by logger, level and message
+// template (or caller, see SetKeyByCaller), the first N records in each interval are logged, then 1 in every M records.
+// When the interval ended, a summary record like "suppressed 4312 similar messages: xxx" is logged by a timer,
+// if there are records dropped. The caller of summary record is the first sampled record of the interval.
+// Summaries are also logged when Flush is called, or by FlushAppenders and CloseAppenders.
+// Message template is the format string for XxxFormat methods, and the first arg for other methods.
+// Critical records, including those logged by Fatal and Panic, are never sampled.
+// One Sampler can be shared by multi loggers, set by Logger.SetSampler.
+type Sampler struct {
+	interval   time.Duration
+	first      int
+	thereafter int
+	byCaller   bool
+	lock       sync.Mutex
+	counters   map[sampleKey]*sampleCounter
+	timer      *time.Timer // sweep counters which interval ended, nil if not running
+}
+
+type sampleKey struct {
+	logger   *Logger
+	level    Level
+	template string
+	pc       uintptr
+}
+
+// the sampling status of one log statement in current interval
+type sampleCounter struct {
+	start      time.Time
+	count      int
+	suppressed int
+	template   string
+	pc         uintptr // the caller of first record
+}
+
+// the summary of suppressed records, to be logged
+type sampleSummary struct {
+	key        sampleKey
+	suppressed int
+	template   string
+	pc         uintptr
+}
+
+// NewSampler create new sampler. For each log statement, first records are logged in every interval,
+// then 1 in every thereafter records are logged. thereafter <= 0 means dropping all records after first records.
+func NewSampler(interval time.Duration, first int, thereafter int) *Sampler {
+	return &Sampler{
+		interval:   interval,
+		first:      first,
+		thereafter: thereafter,
+		counters:   map[sampleKey]*sampleCounter{},
+	}
+}
+
+// SetKeyByCaller identify log statements by caller code position, instead of message template.
+// It is useful when messages are not logged by templates, but costs more to get the caller.
+// This method should be called before sampler start to work.
+func (s *Sampler) SetKeyByCaller(byCaller bool) {
+	s.byCaller = byCaller
+}
+
+// start the timer logging summaries, called when sampler is set to logger
+func (s *Sampler) start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.interval, s.tick)
+	}
+}
+
+// allow check if the record should be logged. The summary of the statement is logged if its interval ended.
+// This method should be called directly in Logger log methods, for getting the right caller.
+func (s *Sampler) allow(logger *Logger, level Level, template string) bool {
+	key := sampleKey{logger: logger, level: level}
+	if s.byCaller {
+		key.pc = sampledCallerPC()
+	} else {
+		key.template = template
+	}
+
+	now := time.Now()
+	var summaries []sampleSummary
+	s.lock.Lock()
+	counter := s.counters[key]
+	if counter == nil || now.Sub(counter.start) >= s.interval {
+		if counter != nil && counter.suppressed > 0 {
+			summaries = append(summaries, counter.summary(key))
+		}
+		counter = &sampleCounter{start: now, template: template, pc: key.pc}
+		if counter.pc == 0 {
+			// once for every interval
+			counter.pc = sampledCallerPC()
+		}
+		s.counters[key] = counter
+		if s.timer == nil {
+			s.timer = time.AfterFunc(s.interval, s.tick)
+		}
+	}
+	counter.count++
+	allowed := counter.count <= s.first || (s.thereafter > 0 && (counter.count-s.first)%s.thereafter == 0)
+	if !allowed {
+		counter.suppressed++
+	}
+	s.lock.Unlock()
+
+	logSummaries(summaries)
+	return allowed
+}
+
+// the caller of logger methods, should be called directly in allow
+func sampledCallerPC() uintptr {
+	var pcs [1]uintptr
+	runtime.Callers(sampleCallerSkip+1, pcs[:])
+	return pcs[0]
+}
+
+func (c *sampleCounter) summary(key sampleKey) sampleSummary {
+	return sampleSummary{key: key, suppressed: c.suppressed, template: c.template, pc: c.pc}
+}
+
+// called by timer, log summaries of counters which interval ended. The timer stops if there are no counters.
+func (s *Sampler) tick() {
+	s.lock.Lock()
+	summaries := s.sweep(time.Now())
+	if len(s.counters) > 0 {
+		s.timer = time.AfterFunc(s.interval, s.tick)
+	} else {
+		s.timer = nil
+	}
+	s.lock.Unlock()
+	logSummaries(summaries)
+}
+
+// remove counters which interval ended, and return the summaries. Should be called with lock held.
+func (s *Sampler) sweep(now time.Time) []sampleSummary {
+	var summaries []sampleSummary
+	for key, counter := range s.counters {
+		if now.Sub(counter.start) < s.interval {
+			continue
+		}
+		if counter.suppressed > 0 {
+			summaries = append(summaries, counter.summary(key))
+		}
+		delete(s.counters, key)
+	}
+	return summaries
+}
+
+// Flush log summaries of all suppressed records now, and reset the sampling status.
+// Samplers set to loggers are flushed by FlushAppenders and CloseAppenders.
+func (s *Sampler) Flush() {
+	var summaries []sampleSummary
+	s.lock.Lock()
+	for key, counter := range s.counters {
+		if counter.suppressed > 0 {
+			summaries = append(summaries, counter.summary(key))
+		}
+		delete(s.counters, key)
+	}
+	s.lock.Unlock()
+	logSummaries(summaries)
+}
+
+func logSummaries(summaries []sampleSummary) {
+	for _, summary := range summaries {
+		logger := summary.key.logger
+		record := LogRecord{
+			Level:    summary.key.level,
+			Message:  "suppressed " + strconv.Itoa(summary.suppressed) + " similar messages: " + summary.template,
+			Fields:   []Field{F("suppressed", summary.suppressed)},
+			callerPC: summary.pc,
+		}
+		if err := logger.writeToAppends(logger.Appenders(), record); err != nil {
+			reportError("log error", err)
+		}
+	}
+}
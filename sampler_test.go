@@ -0,0 +1,145 @@
+package vlog
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lockedAppender collect lines, summaries are appended by timer goroutine
+type lockedAppender struct {
+	*CanFormattedMixin
+	lock   sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (a *lockedAppender) Append(event AppendEvent) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.buffer.Write(event.Message)
+	return nil
+}
+
+// return the lines appended, and reset
+func (a *lockedAppender) lines() []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	lines := strings.Split(strings.TrimSpace(a.buffer.String()), "\n")
+	a.buffer.Reset()
+	return lines
+}
+
+func newSamplerTestLogger(name string) (*Logger, *lockedAppender) {
+	appender := &lockedAppender{CanFormattedMixin: NewAppenderMixin()}
+	appender.SetTransformer(MustNewPatternTransformer("{Level} {message}\n"))
+	logger := GetLogger(name)
+	logger.SetAppenders(appender)
+	return logger, appender
+}
+
+func TestSampler(t *testing.T) {
+	logger, appender := newSamplerTestLogger("sampler_test")
+	sampler := NewSampler(time.Hour, 2, 3)
+	logger.SetSampler(sampler)
+	defer logger.SetSampler(nil)
+
+	for i := 1; i <= 8; i++ {
+		logger.WarnFormat("retry {} failed", i)
+		logger.Info("other message", i)
+	}
+	assert.Equal(t, []string{
+		"Warn retry 1 failed", "Info other message 1",
+		"Warn retry 2 failed", "Info other message 2",
+		"Warn retry 5 failed", "Info other message 5",
+		"Warn retry 8 failed", "Info other message 8",
+	}, appender.lines())
+
+	sampler.Flush()
+	lines := appender.lines()
+	assert.ElementsMatch(t, []string{
+		"Warn suppressed 4 similar messages: retry {} failed",
+		"Info suppressed 4 similar messages: other message",
+	}, lines)
+}
+
+func TestSampler_Interval(t *testing.T) {
+	logger, appender := newSamplerTestLogger("sampler_test/interval")
+	sampler := NewSampler(50*time.Millisecond, 1, 0)
+	sampler.SetKeyByCaller(true)
+	logger.SetSampler(sampler)
+	defer logger.SetSampler(nil)
+
+	for i := 0; i < 3; i++ {
+		logger.Warn("retry", i)
+	}
+	time.Sleep(60 * time.Millisecond)
+	for i := 3; i < 5; i++ {
+		logger.Warn("retry", i)
+	}
+	assert.Equal(t, []string{
+		"Warn retry 0",
+		"Warn suppressed 2 similar messages: retry",
+		"Warn retry 3",
+	}, appender.lines())
+}
+
+func TestSampler_Timer(t *testing.T) {
+	appender := &chanAppender{CanFormattedMixin: NewAppenderMixin(), ch: make(chan string, 10)}
+	appender.SetTransformer(MustNewPatternTransformer("{file} {function} {message}"))
+	logger := GetLogger("sampler_test/timer")
+	logger.SetAppenders(appender)
+	sampler := NewSampler(30*time.Millisecond, 1, 0)
+	logger.SetSampler(sampler)
+	defer logger.SetSampler(nil)
+
+	for i := 0; i < 3; i++ {
+		logger.Warn("retry")
+	}
+	assert.Equal(t, "sampler_test.go TestSampler_Timer retry", <-appender.ch)
+	select {
+	case message := <-appender.ch:
+		assert.Equal(t, "sampler_test.go TestSampler_Timer suppressed 2 similar messages: retry", message)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "summary not logged by timer")
+	}
+	time.Sleep(100 * time.Millisecond)
+	sampler.lock.Lock()
+	assert.Nil(t, sampler.timer)
+	sampler.lock.Unlock()
+}
+
+func TestSampler_FlushAppenders(t *testing.T) {
+	logger, appender := newSamplerTestLogger("sampler_test/flush")
+	logger.SetSampler(NewSampler(time.Hour, 1, 0))
+	defer logger.SetSampler(nil)
+
+	logger.Info("retry")
+	logger.Info("retry")
+	assert.NoError(t, FlushAppenders())
+	assert.Equal(t, []string{"Info retry", "Info suppressed 1 similar messages: retry"}, appender.lines())
+}
+
+func TestSampler_Critical(t *testing.T) {
+	logger, appender := newSamplerTestLogger("sampler_test/critical")
+	logger.SetSampler(NewSampler(time.Hour, 1, 0))
+	defer logger.SetSampler(nil)
+	var codes []int
+	SetExitFunc(func(code int) { codes = append(codes, code) })
+	defer SetExitFunc(nil)
+
+	for i := 0; i < 2; i++ {
+		logger.Critical("disk full")
+		logger.Fatal("server stopped")
+		logger.FatalFormat("server {} stopped", "s1")
+		assert.Panics(t, func() { logger.Panic("invalid state") })
+	}
+	assert.Equal(t, []int{1, 1, 1, 1}, codes)
+	assert.Equal(t, []string{
+		"Critical disk full", "Critical server stopped", "Critical server s1 stopped", "Critical invalid state",
+		"Critical disk full", "Critical server stopped", "Critical server s1 stopped", "Critical invalid state",
+	}, appender.lines())
+}
@@ -38,7 +38,11 @@ type sysLogTransformer struct {
 }
 
 func (st sysLogTransformer) Transform(record LogRecord) AppendEvent {
-	return AppendEvent{Message: record.Message}
+	return AppendEvent{LoggerName: record.LoggerName, Level: record.Level, Message: []byte(record.Message)}
+}
+
+func (st sysLogTransformer) AppendTransform(buf []byte, record LogRecord) []byte {
+	return append(buf, record.Message...)
 }
 
 // NewSyslogAppender create syslog appender, to system syslog daemon.
@@ -68,30 +72,31 @@ func (sa *SyslogAppender) SetLevelMap(levelMap map[Level]syslog.Priority) {
 // Append write one log entry to syslog
 func (sa *SyslogAppender) Append(event AppendEvent) error {
 	var level = event.Level
+	message := string(event.Message)
 	if priority, ok := sa.levelMap[level]; ok {
 		switch priority {
 		case syslog.LOG_DEBUG:
-			return sa.log.Debug(event.Message)
+			return sa.log.Debug(message)
 		case syslog.LOG_INFO:
-			return sa.log.Info(event.Message)
+			return sa.log.Info(message)
 		case syslog.LOG_NOTICE:
-			return sa.log.Notice(event.Message)
+			return sa.log.Notice(message)
 		case syslog.LOG_WARNING:
-			return sa.log.Warning(event.Message)
+			return sa.log.Warning(message)
 		case syslog.LOG_ERR:
-			return sa.log.Err(event.Message)
+			return sa.log.Err(message)
 		case syslog.LOG_CRIT:
-			return sa.log.Crit(event.Message)
+			return sa.log.Crit(message)
 		case syslog.LOG_ALERT:
-			return sa.log.Alert(event.Message)
+			return sa.log.Alert(message)
 		case syslog.LOG_EMERG:
-			return sa.log.Emerg(event.Message)
+			return sa.log.Emerg(message)
 		default:
 			return errors.New("unknown syslog level: " + strconv.Itoa(int(priority)))
 		}
 	}
 
-	_, err := sa.log.Write([]byte(event.Message))
+	_, err := sa.log.Write(event.Message)
 	return err
 }
 
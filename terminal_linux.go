@@ -0,0 +1,17 @@
+//go:build linux
+// +build linux
+
+package vlog
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// isTerminal return if the file is a terminal
+func isTerminal(file *os.File) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
@@ -1,18 +1,25 @@
 package vlog
 
 import (
+	"context"
 	"errors"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // LogRecord is one log message
 type LogRecord struct {
-	LoggerName string    // logger name
-	Level      Level     // the level of this logger record
-	LogTime    time.Time // Time
-	Message    string    // the log message
+	LoggerName string          // logger name
+	Level      Level           // the level of this logger record
+	LogTime    time.Time       // Time
+	Message    string          // the log message
+	Fields     []Field         // the fields passed to logger with vlog.F
+	Context    context.Context // the context passed to logger, may be nil
+	callerSkip int             // extra stack frames to skip when getting caller, for transformers calling other transformers
+	callerPC   uintptr         // the program counter of caller if not zero, for records not logged by user code directly
 }
 
 // Transformer convert one log record to byte array data.
@@ -21,6 +28,15 @@ type Transformer interface {
 	Transform(record LogRecord) AppendEvent
 }
 
+// AppendTransformer is a Transformer can also append the transformed data to a byte slice.
+// Logger calls AppendTransform with pooled buffers instead of Transform, to avoid allocation for each log.
+// AppendTransform is called in the same way as Transform, directly in the goroutine calling logger methods.
+type AppendTransformer interface {
+	Transformer
+	// AppendTransform append the transformed data of record to buf, and return the extended buffer
+	AppendTransform(buf []byte, record LogRecord) []byte
+}
+
 var defaultTransformer = NewDefaultPatternTransformer()
 
 // DefaultTransformer the default transformer used if not set
@@ -28,12 +44,13 @@ func DefaultTransformer() Transformer {
 	return defaultTransformer
 }
 
-var _ Transformer = (*PatternTransformer)(nil)
+var _ AppendTransformer = (*PatternTransformer)(nil)
 
 // PatternTransformer transform one log record using pattern, to string
 type PatternTransformer struct {
 	pattern string
 	items   []patternItem
+	color   bool // if output ansi color codes for {color:xxx} and {/color}
 }
 
 type kind int32
@@ -50,12 +67,71 @@ const (
 	loggerLevelLower kind = 13
 	timestamp        kind = 20
 	logMessage       kind = 21
+	colorStart       kind = 30
+	colorEnd         kind = 31
+	constant         kind = 40
+	goroutine        kind = 41
+	elapsed          kind = 42
+	oneField         kind = 43
+	allFields        kind = 44
+	errorText        kind = 45
+	stackTrace       kind = 46
+	customVariable   kind = 50
 )
 
+// the time vlog package initialized, used as process start time
+var processStartTime = time.Now()
+
 type patternItem struct {
-	kind   kind   // item type
-	str    string // for text item, hold the content of text
-	filter string // the filter
+	kind     kind                // item type
+	str      string              // text content for text and constant item; ansi code for colorStart item, empty for level color; key for field item
+	layout   string              // the time layout, for timestamp item
+	location *time.Location      // the time zone, for timestamp item. nil means using the default time zone
+	filters  []stringFilter      // filters applied to variable value
+	width    *widthSpec          // width filter applied in place, if it is the only filter
+	variable PatternVariableFunc // for custom variable item
+}
+
+const colorReset = "\x1b[0m"
+
+// ansi color codes can be used in {color:xxx}
+var colorCodes = map[string]string{
+	"black":     "30",
+	"red":       "31",
+	"green":     "32",
+	"yellow":    "33",
+	"blue":      "34",
+	"magenta":   "35",
+	"cyan":      "36",
+	"white":     "37",
+	"gray":      "90",
+	"bold":      "1",
+	"dim":       "2",
+	"italic":    "3",
+	"underline": "4",
+}
+
+// ansi color codes for {color:level}
+var levelColors = map[Level]string{
+	Trace:    "\x1b[90m",
+	Debug:    "\x1b[36m",
+	Info:     "\x1b[32m",
+	Warn:     "\x1b[33m",
+	Error:    "\x1b[31m",
+	Critical: "\x1b[1;35m",
+}
+
+// parse color names like bold+red to ansi escape sequence
+func parseColor(names string) (string, error) {
+	var codes []string
+	for _, name := range strings.Split(names, "+") {
+		code, ok := colorCodes[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return "", errors.New("unknown color: " + name)
+		}
+		codes = append(codes, code)
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m", nil
 }
 
 // MustNewPatternTransformer create new pattern transformer, just as NewPatternTransformer do.
@@ -79,8 +155,40 @@ func MustNewPatternTransformer(pattern string) *PatternTransformer {
 // {logger} the logger name
 // {Level}/{level}/{LEVEL} the logger level, with different character case
 // {message} the log message
+// {pid} the process id
+// {hostname} the host name
+// {goroutine} the id of current goroutine
+// {elapsed} milliseconds elapsed since process start
+// {env:NAME} the value of environment variable NAME, resolved when transformer is created
+// {field:key} the value of field with key, or empty if no such field
+// {fields} all fields, as key=value pairs delimited with white space
+// {error} the error passed by vlog.Err/vlog.ErrWithStack, with error type and causes chain, or empty if no such field
+// {stack} the stack trace captured by vlog.ErrWithStack, or empty if no such field
 // use {{ to escape  {, use }} to escape }
 // {time} can set custom format via filter, by {time|2006-01-02 15:04:05.000}
+// {time} layout can also be shorthands: RFC3339, RFC3339Milli, RFC3339Nano, RFC1123, RFC1123Z,
+// or epoch time: unix, unixmilli, unixmicro, unixnano.
+// {time} can set time zone by filter after layout, such as {time|2006-01-02T15:04:05Z07:00|UTC},
+// {time|RFC3339|Asia/Shanghai}, or {time||Local}. The default time zone can be set by SetDefaultTimeZone.
+//
+// Filters can be set after variable name, delimited by '|', and are applied in order. For {time}, the first filter is
+// always the time layout. Below filters can be used:
+// width: as logback, -5 means pad to at least 5 chars with left justify, 20 means pad to at least 20 chars with right
+// justify, 20.30 means also truncate to at most 30 chars, removing chars from the beginning, and 20.-30 removes chars
+// from the end. For example, {Level|-5}, {logger|20.20}.
+// abbr: abbreviate path like names, github.com/user/pkg to g.c.u.pkg, the last segment is kept.
+// abbr:N: abbreviate segments from the left, only until the result has at most N chars.
+// upper/lower: convert to upper/lower case.
+// trim: remove leading and trailing white spaces.
+// json: escape as content of json string.
+// default:x: use x if the value is empty.
+//
+// Custom variables and filters can be registered by RegisterPatternVariable and RegisterPatternFilter.
+//
+// ANSI colors can be set by {color:xxx}...{/color}, xxx can be: level(color by log level), black, red, green, yellow,
+// blue, magenta, cyan, white, gray, bold, dim, italic, underline, or combination like bold+red.
+// Colors are always output by transformer created by NewPatternTransformer, use NewConsoleTransformer to disable colors
+// automatically when not writing to terminal.
 func NewPatternTransformer(pattern string) (*PatternTransformer, error) {
 	type State int
 	const (
@@ -120,29 +228,11 @@ func NewPatternTransformer(pattern string) (*PatternTransformer, error) {
 			if r == '}' || r == '|' {
 				name := string(buffer)
 				buffer = buffer[:0]
-				if name == "file" {
-					items = append(items, patternItem{kind: goFile})
-				} else if name == "package" {
-					items = append(items, patternItem{kind: goPackage})
-				} else if name == "function" {
-					items = append(items, patternItem{kind: goFunction})
-				} else if name == "line" {
-					items = append(items, patternItem{kind: lineNum})
-				} else if name == "time" {
-					items = append(items, patternItem{kind: timestamp})
-				} else if name == "logger" {
-					items = append(items, patternItem{kind: loggerName})
-				} else if name == "message" {
-					items = append(items, patternItem{kind: logMessage})
-				} else if name == "Level" {
-					items = append(items, patternItem{kind: loggerLevel})
-				} else if name == "level" {
-					items = append(items, patternItem{kind: loggerLevelLower})
-				} else if name == "LEVEL" {
-					items = append(items, patternItem{kind: loggerLevelUpper})
-				} else {
-					return nil, errors.New("unknown variable name: " + name)
+				item, err := parseVariable(name)
+				if err != nil {
+					return nil, err
 				}
+				items = append(items, item)
 				if r == '}' {
 					state = normalState
 				} else if r == '|' {
@@ -160,8 +250,8 @@ func NewPatternTransformer(pattern string) (*PatternTransformer, error) {
 			}
 		case inVariableFilter:
 			if r == '}' {
-				if str := string(buffer); len(str) > 0 {
-					(&items[len(items)-1]).filter = str
+				if err := setFilters(&items[len(items)-1], string(buffer)); err != nil {
+					return nil, err
 				}
 				buffer = buffer[:0]
 				state = normalState
@@ -180,7 +270,137 @@ func NewPatternTransformer(pattern string) (*PatternTransformer, error) {
 		items = append(items, patternItem{kind: text, str: str})
 	}
 
-	return &PatternTransformer{pattern: pattern, items: items}, nil
+	return &PatternTransformer{pattern: pattern, items: items, color: true}, nil
+}
+
+// parse variable name to pattern item
+func parseVariable(name string) (patternItem, error) {
+	switch name {
+	case "file":
+		return patternItem{kind: goFile}, nil
+	case "package":
+		return patternItem{kind: goPackage}, nil
+	case "function":
+		return patternItem{kind: goFunction}, nil
+	case "line":
+		return patternItem{kind: lineNum}, nil
+	case "time":
+		return patternItem{kind: timestamp}, nil
+	case "logger":
+		return patternItem{kind: loggerName}, nil
+	case "message":
+		return patternItem{kind: logMessage}, nil
+	case "Level":
+		return patternItem{kind: loggerLevel}, nil
+	case "level":
+		return patternItem{kind: loggerLevelLower}, nil
+	case "LEVEL":
+		return patternItem{kind: loggerLevelUpper}, nil
+	case "pid":
+		return patternItem{kind: constant, str: strconv.Itoa(os.Getpid())}, nil
+	case "hostname":
+		hostname, _ := os.Hostname()
+		return patternItem{kind: constant, str: hostname}, nil
+	case "goroutine":
+		return patternItem{kind: goroutine}, nil
+	case "elapsed":
+		return patternItem{kind: elapsed}, nil
+	case "fields":
+		return patternItem{kind: allFields}, nil
+	case "error":
+		return patternItem{kind: errorText}, nil
+	case "stack":
+		return patternItem{kind: stackTrace}, nil
+	case "color:level":
+		return patternItem{kind: colorStart}, nil
+	case "/color":
+		return patternItem{kind: colorEnd}, nil
+	}
+
+	if strings.HasPrefix(name, "env:") {
+		return patternItem{kind: constant, str: os.Getenv(name[len("env:"):])}, nil
+	}
+	if strings.HasPrefix(name, "field:") {
+		return patternItem{kind: oneField, str: name[len("field:"):]}, nil
+	}
+	if strings.HasPrefix(name, "color:") {
+		code, err := parseColor(name[len("color:"):])
+		if err != nil {
+			return patternItem{}, err
+		}
+		return patternItem{kind: colorStart, str: code}, nil
+	}
+
+	variableName, arg := name, ""
+	if idx := strings.IndexByte(name, ':'); idx >= 0 {
+		variableName, arg = name[:idx], name[idx+1:]
+	}
+	patternVariablesLock.RLock()
+	variable, ok := patternVariables[variableName]
+	patternVariablesLock.RUnlock()
+	if ok {
+		return patternItem{kind: customVariable, str: arg, variable: variable}, nil
+	}
+	return patternItem{}, errors.New("unknown variable name: " + name)
+}
+
+// PatternVariableFunc is a custom variable for PatternTransformer, append the variable value of record to buf.
+// arg is the variable argument after ':', for example, for {tenant:id}, arg is "id".
+// The func is called in the goroutine calling logger methods.
+type PatternVariableFunc func(record *LogRecord, arg string, buf *[]byte)
+
+var builtinVariables = map[string]bool{
+	"file": true, "package": true, "function": true, "line": true, "time": true, "logger": true, "message": true,
+	"Level": true, "level": true, "LEVEL": true, "pid": true, "hostname": true, "goroutine": true, "elapsed": true,
+	"fields": true, "env": true, "field": true, "color": true, "error": true, "stack": true,
+}
+var patternVariables = map[string]PatternVariableFunc{}
+var patternVariablesLock sync.RWMutex
+
+// RegisterPatternVariable register a custom variable, which can be used in PatternTransformer pattern,
+// as {name} or {name:arg}. Variables should be registered before creating transformers using them.
+// RegisterPatternVariable panics if the name is empty, contains ':' or '|', is a builtin variable name,
+// or is already registered.
+func RegisterPatternVariable(name string, variable PatternVariableFunc) {
+	if name == "" || strings.ContainsAny(name, ":|{}") || builtinVariables[name] || strings.HasPrefix(name, "/") {
+		panic("vlog: invalid pattern variable name: " + name)
+	}
+	if variable == nil {
+		panic("vlog: pattern variable is nil: " + name)
+	}
+	patternVariablesLock.Lock()
+	defer patternVariablesLock.Unlock()
+	if _, ok := patternVariables[name]; ok {
+		panic("vlog: pattern variable already registered: " + name)
+	}
+	patternVariables[name] = variable
+}
+
+// DefaultConsolePattern is the default pattern of ConsoleTransformer, with level colored, time dimmed,
+// and logger name highlighted
+const DefaultConsolePattern = "{color:dim}{time}{/color} [{color:level}{Level|-5}{/color}] {color:cyan}{logger}{/color} - {message}\n"
+
+// NewConsoleTransformer create pattern transformer for console output.
+// Colors in pattern are output only when file is a terminal, and NO_COLOR env is not set.
+// If pattern is empty, DefaultConsolePattern is used.
+func NewConsoleTransformer(pattern string, file *os.File) (*PatternTransformer, error) {
+	if pattern == "" {
+		pattern = DefaultConsolePattern
+	}
+	transformer, err := NewPatternTransformer(pattern)
+	if err != nil {
+		return nil, err
+	}
+	transformer.color = colorEnabled(file)
+	return transformer, nil
+}
+
+// colorEnabled return if should output colors to file, see https://no-color.org
+func colorEnabled(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(file)
 }
 
 // NewDefaultPatternTransformer return formatter with default format
@@ -194,57 +414,148 @@ func NewDefaultPatternTransformer() *PatternTransformer {
 
 // Transform format log data to byte array data
 func (f *PatternTransformer) Transform(record LogRecord) AppendEvent {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.b = f.format(buf.b, &record)
+	message := append([]byte(nil), buf.b...)
+	return AppendEvent{LoggerName: record.LoggerName, Level: record.Level, Message: message}
+}
 
-	var logItems []string
+// AppendTransform append formatted log data to buf
+func (f *PatternTransformer) AppendTransform(buf []byte, record LogRecord) []byte {
+	return f.format(buf, &record)
+}
+
+// format log record and append to buf. This method should be called directly by Transform/AppendTransform,
+// for getting the right caller.
+func (f *PatternTransformer) format(buf []byte, record *LogRecord) []byte {
 	var caller *caller
-	depth := 5
-	for _, item := range f.items {
+	depth := transformCallerDepth + 1 + record.callerSkip
+	for idx := range f.items {
+		item := &f.items[idx]
+		start := len(buf)
 		switch item.kind {
 		case text:
-			logItems = append(logItems, item.str)
-		case timestamp:
-			var timeFormat string
-			if item.filter == "" {
-				timeFormat = "2006-01-02 15:04:05.000"
-			} else {
-				timeFormat = item.filter
+			buf = append(buf, item.str...)
+			continue
+		case colorStart:
+			if f.color {
+				if item.str == "" {
+					buf = append(buf, levelColors[record.Level]...)
+				} else {
+					buf = append(buf, item.str...)
+				}
 			}
-			logItems = append(logItems, record.LogTime.Format(timeFormat))
+			continue
+		case colorEnd:
+			if f.color {
+				buf = append(buf, colorReset...)
+			}
+			continue
+		case timestamp:
+			buf = appendTime(buf, record.LogTime, item.layout, item.location)
 		case loggerName:
-			logItems = append(logItems, record.LoggerName)
+			buf = append(buf, record.LoggerName...)
 		case loggerLevel:
-			logItems = append(logItems, record.Level.Name())
+			buf = append(buf, record.Level.Name()...)
 		case loggerLevelUpper:
-			logItems = append(logItems, strings.ToUpper(record.Level.Name()))
+			buf = appendUpper(buf, record.Level.Name())
 		case loggerLevelLower:
-			logItems = append(logItems, strings.ToLower(record.Level.Name()))
+			buf = appendLower(buf, record.Level.Name())
 		case logMessage:
-			logItems = append(logItems, record.Message)
+			buf = append(buf, record.Message...)
 		case goPackage:
 			if caller == nil {
-				caller = getCaller(depth)
+				caller = getRecordCaller(record, depth)
 			}
-			logItems = append(logItems, caller.packageName)
+			buf = append(buf, caller.packageName...)
 		case goFile:
 			if caller == nil {
-				caller = getCaller(depth)
+				caller = getRecordCaller(record, depth)
 			}
-			logItems = append(logItems, caller.fileName)
+			buf = append(buf, caller.fileName...)
 		case goFunction:
 			if caller == nil {
-				caller = getCaller(depth)
+				caller = getRecordCaller(record, depth)
 			}
-			logItems = append(logItems, caller.functionName)
+			buf = append(buf, caller.functionName...)
 		case lineNum:
 			if caller == nil {
-				caller = getCaller(depth)
+				caller = getRecordCaller(record, depth)
 			}
-			logItems = append(logItems, strconv.Itoa(caller.line))
+			buf = strconv.AppendInt(buf, int64(caller.line), 10)
+		case constant:
+			buf = append(buf, item.str...)
+		case goroutine:
+			buf = strconv.AppendUint(buf, goroutineID(), 10)
+		case elapsed:
+			buf = strconv.AppendInt(buf, int64(record.LogTime.Sub(processStartTime)/time.Millisecond), 10)
+		case oneField:
+			for _, field := range record.Fields {
+				if field.Key == item.str {
+					buf = append(buf, fieldText(field.Value)...)
+					break
+				}
+			}
+		case allFields:
+			for idx, field := range record.Fields {
+				if idx > 0 {
+					buf = append(buf, ' ')
+				}
+				buf = append(buf, field.Key...)
+				buf = append(buf, '=')
+				buf = append(buf, quoteFieldText(fieldText(field.Value))...)
+			}
+		case errorText:
+			if ev := findErrorValue(record.Fields); ev != nil {
+				buf = appendErrorText(buf, ev)
+			}
+		case stackTrace:
+			if ev := findErrorValue(record.Fields); ev != nil {
+				buf = appendStack(buf, ev.stack)
+			}
+		case customVariable:
+			// copy record and buf, so they are allocated on heap only when custom variables are used
+			r, b := *record, buf
+			item.variable(&r, item.str, &b)
+			buf = b
 		default:
 			panic("unsupported type: " + strconv.Itoa(int(item.kind)))
 		}
+		if len(item.filters) > 0 {
+			value := string(buf[start:])
+			for _, filter := range item.filters {
+				value = filter(value)
+			}
+			buf = append(buf[:start], value...)
+		}
+		if item.width != nil {
+			buf = item.width.apply(buf, start)
+		}
+	}
+	return buf
+}
+
+// append ascii upper case of str to buf
+func appendUpper(buf []byte, str string) []byte {
+	for idx := 0; idx < len(str); idx++ {
+		c := str[idx]
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		buf = append(buf, c)
 	}
+	return buf
+}
 
-	var message = strings.Join(logItems, "")
-	return AppendEvent{Message: message}
+// append ascii lower case of str to buf
+func appendLower(buf []byte, str string) []byte {
+	for idx := 0; idx < len(str); idx++ {
+		c := str[idx]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		buf = append(buf, c)
+	}
+	return buf
 }
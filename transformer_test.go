@@ -1 +1,73 @@
 package vlog
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatternTransformer_Color(t *testing.T) {
+	transformer, err := NewPatternTransformer("{color:level}{Level}{/color} {color:bold+cyan}{logger}{/color} {message}")
+	assert.NoError(t, err)
+	event := transformer.Transform(LogRecord{LoggerName: "test", Level: Error, LogTime: time.Now(), Message: "msg"})
+	assert.Equal(t, "\x1b[31mError\x1b[0m \x1b[1;36mtest\x1b[0m msg", string(event.Message))
+
+	_, err = NewPatternTransformer("{color:pink}{message}{/color}")
+	assert.Error(t, err)
+}
+
+func TestNewConsoleTransformer(t *testing.T) {
+	file, err := ioutil.TempFile("", "vlog")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// not a terminal
+	transformer, err := NewConsoleTransformer("{color:level}{Level}{/color} {message}", file)
+	assert.NoError(t, err)
+	event := transformer.Transform(LogRecord{Level: Warn, LogTime: time.Now(), Message: "msg"})
+	assert.Equal(t, "Warn msg", string(event.Message))
+
+	if value, ok := os.LookupEnv("NO_COLOR"); ok {
+		defer os.Setenv("NO_COLOR", value)
+	} else {
+		defer os.Unsetenv("NO_COLOR")
+	}
+	os.Setenv("NO_COLOR", "1")
+	assert.False(t, colorEnabled(os.Stdout))
+}
+
+func TestPatternTransformer_ExtendedVariables(t *testing.T) {
+	os.Setenv("VLOG_TEST_APP", "app1")
+	defer os.Unsetenv("VLOG_TEST_APP")
+	transformer, err := NewPatternTransformer("{pid} {hostname} {env:VLOG_TEST_APP} {elapsed} {field:user} {fields}")
+	assert.NoError(t, err)
+	hostname, _ := os.Hostname()
+	event := transformer.Transform(LogRecord{
+		LogTime: processStartTime.Add(1500 * time.Millisecond),
+		Message: "msg",
+		Fields:  []Field{F("user", "tom"), F("path", "/a b"), F("empty", "")},
+	})
+	assert.Equal(t, strconv.Itoa(os.Getpid())+" "+hostname+" app1 1500 tom user=tom path=\"/a b\" empty=\"\"", string(event.Message))
+
+	event = transformer.Transform(LogRecord{LogTime: processStartTime, Message: "msg"})
+	assert.Equal(t, strconv.Itoa(os.Getpid())+" "+hostname+" app1 0  ", string(event.Message))
+}
+
+func TestPatternTransformer_Goroutine(t *testing.T) {
+	transformer := MustNewPatternTransformer("{goroutine}")
+	var ids = make(chan string, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			ids <- string(transformer.Transform(LogRecord{}).Message)
+		}()
+	}
+	id1, id2 := <-ids, <-ids
+	assert.NotEqual(t, id1, id2)
+	_, err := strconv.ParseUint(id1, 10, 64)
+	assert.NoError(t, err)
+}
@@ -17,6 +17,10 @@ func (we *wrappedError) Error() string {
 	return we.message + ": " + we.cause.Error()
 }
 
+func (we *wrappedError) Unwrap() error {
+	return we.cause
+}
+
 func wrapError(message string, err error) error {
 	return &wrappedError{message: message, cause: err}
 }
@@ -0,0 +1,372 @@
+// Package vloghttp provides net/http middleware logging access logs with vlog.
+package vloghttp
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsiafan/vlog"
+)
+
+// Format is the message format of access logs
+type Format int
+
+const (
+	// FormatCommon is the Common Log Format:
+	// 127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326
+	FormatCommon Format = iota
+	// FormatCombined is the Combined Log Format, Common Log Format with referer and user agent
+	FormatCombined
+	// FormatJSON output access log as json object
+	FormatJSON
+)
+
+// the time layout used by Common Log Format
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// DefaultRequestIDHeader is the default header to read and write request id
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// the max length of request id read from request, longer ones are replaced by generated ids
+const maxRequestIDLength = 128
+
+var _ http.Handler = (*AccessLogHandler)(nil)
+
+// AccessLogHandler is a http.Handler middleware, log one record for each request with method, path, status, bytes,
+// duration, remote address, user agent and request id. The values are also passed as fields of log record,
+// so appenders sending structured data can send them as separate fields.
+//
+// The logger and request id are injected into the request context, and can be get by FromContext and RequestID.
+type AccessLogHandler struct {
+	next            http.Handler
+	logger          *vlog.Logger
+	contextLogger   *vlog.Logger
+	format          Format
+	statusLevels    [6]vlog.Level // index by status class, 1xx-5xx
+	excludePaths    map[string]bool
+	requestIDHeader string
+}
+
+// NewAccessLogHandler create access log middleware for next handler, logging with logger.
+// By default, logs are in Common Log Format, and 1xx/2xx/3xx responses are logged with Info level,
+// 4xx with Warn level, 5xx with Error level.
+func NewAccessLogHandler(next http.Handler, logger *vlog.Logger) *AccessLogHandler {
+	return &AccessLogHandler{
+		next:            next,
+		logger:          logger,
+		contextLogger:   logger,
+		format:          FormatCommon,
+		statusLevels:    [6]vlog.Level{vlog.Info, vlog.Info, vlog.Info, vlog.Info, vlog.Warn, vlog.Error},
+		excludePaths:    map[string]bool{},
+		requestIDHeader: DefaultRequestIDHeader,
+	}
+}
+
+// SetFormat set the format of access log messages.
+// This method should be called before handler start to work.
+func (h *AccessLogHandler) SetFormat(format Format) {
+	h.format = format
+}
+
+// SetStatusLevel set the log level for responses of status class, 1 for 1xx, 2 for 2xx, and so on.
+// Set level to vlog.Off to not log the responses.
+// This method should be called before handler start to work.
+func (h *AccessLogHandler) SetStatusLevel(statusClass int, level vlog.Level) {
+	if statusClass < 1 || statusClass > 5 {
+		panic("vloghttp: invalid status class: " + strconv.Itoa(statusClass))
+	}
+	h.statusLevels[statusClass] = level
+}
+
+// SetExcludePaths set request paths not logged, such as health check paths. Paths are matched exactly.
+// This method should be called before handler start to work.
+func (h *AccessLogHandler) SetExcludePaths(paths ...string) {
+	h.excludePaths = map[string]bool{}
+	for _, path := range paths {
+		h.excludePaths[path] = true
+	}
+}
+
+// SetRequestIDHeader set the header name to read request id from request. If the request has no request id,
+// or the request id is longer than 128 chars or has chars other than http token chars, a random one is generated.
+// The request id is also set to the response header.
+// This method should be called before handler start to work.
+func (h *AccessLogHandler) SetRequestIDHeader(header string) {
+	h.requestIDHeader = header
+}
+
+// SetContextLogger set the logger injected into request context, for handlers logging in request scope.
+// Default is the access logger.
+// This method should be called before handler start to work.
+func (h *AccessLogHandler) SetContextLogger(logger *vlog.Logger) {
+	h.contextLogger = logger
+}
+
+// ServeHTTP serve request by next handler, and log the access record
+func (h *AccessLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	requestID := r.Header.Get(h.requestIDHeader)
+	if !validRequestID(requestID) {
+		requestID = newRequestID()
+	}
+	w.Header().Set(h.requestIDHeader, requestID)
+	r = r.WithContext(newContext(r.Context(), h.contextLogger, requestID))
+
+	rw := &responseWriter{ResponseWriter: w}
+	h.next.ServeHTTP(rw, r)
+
+	if h.excludePaths[r.URL.Path] {
+		return
+	}
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	level := vlog.Error
+	if class := rw.status / 100; class >= 1 && class <= 5 {
+		level = h.statusLevels[class]
+	}
+	if level >= vlog.Off || h.logger.Level() > level {
+		return
+	}
+
+	entry := &accessEntry{
+		Time:      start,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     r.URL.RawQuery,
+		URI:       requestURI(r),
+		Protocol:  r.Proto,
+		Status:    rw.status,
+		Bytes:     rw.bytes,
+		Duration:  time.Since(start),
+		Remote:    remoteHost(r.RemoteAddr),
+		User:      userName(r),
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+		RequestID: requestID,
+	}
+	logAtLevel(h.logger, level, entry.message(h.format), r.Context(),
+		vlog.F("method", entry.Method),
+		vlog.F("path", entry.Path),
+		vlog.F("status", entry.Status),
+		vlog.F("bytes", entry.Bytes),
+		vlog.F("duration", entry.Duration),
+		vlog.F("remote", entry.Remote),
+		vlog.F("user_agent", entry.UserAgent),
+		vlog.F("request_id", entry.RequestID),
+	)
+}
+
+func logAtLevel(logger *vlog.Logger, level vlog.Level, message string, args ...interface{}) {
+	switch {
+	case level >= vlog.Critical:
+		logger.Critical(message, args...)
+	case level >= vlog.Error:
+		logger.Error(message, args...)
+	case level >= vlog.Warn:
+		logger.Warn(message, args...)
+	case level >= vlog.Info:
+		logger.Info(message, args...)
+	case level >= vlog.Debug:
+		logger.Debug(message, args...)
+	default:
+		logger.Trace(message, args...)
+	}
+}
+
+// accessEntry is the values of one access log
+type accessEntry struct {
+	Time      time.Time     `json:"time"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Query     string        `json:"query,omitempty"`
+	URI       string        `json:"-"` // the escaped request uri, for text formats
+	Protocol  string        `json:"protocol"`
+	Status    int           `json:"status"`
+	Bytes     int64         `json:"bytes"`
+	Duration  time.Duration `json:"-"`
+	Remote    string        `json:"remote"`
+	User      string        `json:"user,omitempty"`
+	Referer   string        `json:"referer,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty"`
+	RequestID string        `json:"request_id"`
+}
+
+func (e *accessEntry) message(format Format) string {
+	if format == FormatJSON {
+		return e.jsonMessage()
+	}
+	buf := make([]byte, 0, 256)
+	// values from client are escaped, to not break the line or forge other entries
+	buf = appendEscaped(buf, e.Remote)
+	buf = append(buf, " - "...)
+	if e.User == "" {
+		buf = append(buf, '-')
+	} else {
+		buf = appendEscaped(buf, e.User)
+	}
+	buf = append(buf, " ["...)
+	buf = e.Time.AppendFormat(buf, clfTimeLayout)
+	buf = append(buf, "] \""...)
+	buf = appendEscaped(buf, e.Method)
+	buf = append(buf, ' ')
+	buf = appendEscaped(buf, e.URI)
+	buf = append(buf, ' ')
+	buf = appendEscaped(buf, e.Protocol)
+	buf = append(buf, "\" "...)
+	buf = strconv.AppendInt(buf, int64(e.Status), 10)
+	buf = append(buf, ' ')
+	if e.Bytes > 0 {
+		buf = strconv.AppendInt(buf, e.Bytes, 10)
+	} else {
+		buf = append(buf, '-')
+	}
+	if format == FormatCombined {
+		buf = append(buf, " \""...)
+		buf = appendEscaped(buf, e.Referer)
+		buf = append(buf, "\" \""...)
+		buf = appendEscaped(buf, e.UserAgent)
+		buf = append(buf, '"')
+	}
+	return string(buf)
+}
+
+func (e *accessEntry) jsonMessage() string {
+	data, err := json.Marshal(struct {
+		*accessEntry
+		DurationMillis float64 `json:"duration_ms"`
+	}{e, float64(e.Duration) / float64(time.Millisecond)})
+	if err != nil {
+		// should not happen
+		return err.Error()
+	}
+	return string(data)
+}
+
+const hexDigits = "0123456789abcdef"
+
+// append value with '"' and '\\' escaped by '\\', and control chars escaped as \xhh, as apache httpd does
+func appendEscaped(buf []byte, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < 0x20 || c == 0x7f:
+			buf = append(buf, '\\', 'x', hexDigits[c>>4], hexDigits[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// the request uri as sent by client, not decoded
+func requestURI(r *http.Request) string {
+	if r.RequestURI != "" {
+		return r.RequestURI
+	}
+	return r.URL.RequestURI()
+}
+
+// if request id from client is not empty, not too long, and only has http token chars
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// the host part of remote address
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// the user name of basic auth, or in url
+func userName(r *http.Request) string {
+	if r.URL.User != nil {
+		return r.URL.User.Username()
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	return ""
+}
+
+// generate random request id, 16 hex chars
+func newRequestID() string {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// responseWriter record the status and bytes written
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(data)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Flush implement http.Flusher, if the underlying writer supported
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Hijack implement http.Hijacker, if the underlying writer supported
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("vloghttp: underlying response writer is not a http.Hijacker")
+	}
+	if rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap return the underlying response writer, for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
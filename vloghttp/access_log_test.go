@@ -0,0 +1,164 @@
+package vloghttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsiafan/vlog"
+	"github.com/hsiafan/vlog/vlogtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func testHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/missing":
+		http.NotFound(w, r)
+	case "/fail":
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		FromContext(r.Context()).Info(r.Context(), "handling")
+		_, _ = w.Write([]byte("hello"))
+	}
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	r.RemoteAddr = "10.0.0.1:52000"
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	return recorder
+}
+
+func TestAccessLogHandler_Common(t *testing.T) {
+	logger := vlog.GetLogger("vloghttp/test/common")
+	capture := vlogtest.CaptureLogger(t, logger)
+	handler := NewAccessLogHandler(http.HandlerFunc(testHandler), logger)
+
+	r := httptest.NewRequest("GET", "/hello?name=v", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	r.SetBasicAuth("frank", "secret")
+	recorder := serve(handler, r)
+	assert.Equal(t, "req-1", recorder.Header().Get("X-Request-ID"))
+
+	records := capture.Records()
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, "handling", records[0].Message)
+	assert.Equal(t, "req-1", RequestID(records[0].Context))
+
+	record := records[1]
+	assert.Equal(t, vlog.Info, record.Level)
+	assert.Regexp(t, `^10\.0\.0\.1 - frank \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [-+]\d{4}\] "GET /hello\?name=v HTTP/1\.1" 200 5$`,
+		record.Message)
+	fields := map[string]interface{}{}
+	for _, field := range record.Fields {
+		fields[field.Key] = field.Value
+	}
+	assert.Equal(t, "GET", fields["method"])
+	assert.Equal(t, "/hello", fields["path"])
+	assert.Equal(t, 200, fields["status"])
+	assert.Equal(t, int64(5), fields["bytes"])
+	assert.Equal(t, "10.0.0.1", fields["remote"])
+	assert.Equal(t, "req-1", fields["request_id"])
+	assert.IsType(t, time.Duration(0), fields["duration"])
+}
+
+func TestAccessLogHandler_Combined(t *testing.T) {
+	logger := vlog.GetLogger("vloghttp/test/combined")
+	capture := vlogtest.CaptureLogger(t, logger)
+	handler := NewAccessLogHandler(http.HandlerFunc(testHandler), logger)
+	handler.SetFormat(FormatCombined)
+
+	r := httptest.NewRequest("GET", "/missing", nil)
+	r.Header.Set("Referer", "http://example.com/")
+	r.Header.Set("User-Agent", "test-agent")
+	recorder := serve(handler, r)
+	assert.Len(t, recorder.Header().Get("X-Request-ID"), 16)
+
+	capture.AssertContains(t, vlog.Warn, `"GET /missing HTTP/1\.1" 404 \d+ "http://example\.com/" "test-agent"$`)
+}
+
+func TestAccessLogHandler_Escape(t *testing.T) {
+	logger := vlog.GetLogger("vloghttp/test/escape")
+	capture := vlogtest.CaptureLogger(t, logger)
+	handler := NewAccessLogHandler(http.HandlerFunc(testHandler), logger)
+	handler.SetFormat(FormatCombined)
+
+	forged := `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /admin HTTP/1.1" 200`
+	r := httptest.NewRequest("GET", "/a%0A"+url.PathEscape(forged), nil)
+	r.Header.Set("User-Agent", "agent\n\"forged\"")
+	r.Header.Set("X-Request-ID", "id\x01")
+	recorder := serve(handler, r)
+	requestID := recorder.Header().Get("X-Request-ID")
+	assert.Len(t, requestID, 16)
+
+	records := capture.Records()
+	assert.Equal(t, 2, len(records))
+	message := records[1].Message
+	assert.NotContains(t, message, "\n")
+	assert.Contains(t, message, `"GET /a%0A127.0.0.1`)
+	assert.Contains(t, message, `"agent\x0a\"forged\""`)
+	assert.Equal(t, requestID, RequestID(records[0].Context))
+
+	r = httptest.NewRequest("GET", "/hello", nil)
+	r.Header.Set("X-Request-ID", strings.Repeat("a", 129))
+	assert.Len(t, serve(handler, r).Header().Get("X-Request-ID"), 16)
+	r.Header.Set("X-Request-ID", "0f8fad5b-d9cb-469f-a165-70867728950e")
+	assert.Equal(t, "0f8fad5b-d9cb-469f-a165-70867728950e", serve(handler, r).Header().Get("X-Request-ID"))
+}
+
+func TestAccessLogHandler_JSON(t *testing.T) {
+	logger := vlog.GetLogger("vloghttp/test/json")
+	capture := vlogtest.CaptureLogger(t, logger)
+	handler := NewAccessLogHandler(http.HandlerFunc(testHandler), logger)
+	handler.SetFormat(FormatJSON)
+
+	serve(handler, httptest.NewRequest("POST", "/fail", nil))
+	records := capture.Find(vlog.Error, ".*")
+	assert.Equal(t, 1, len(records))
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(records[0].Message), &entry))
+	assert.Equal(t, "POST", entry["method"])
+	assert.Equal(t, "/fail", entry["path"])
+	assert.Equal(t, float64(500), entry["status"])
+	assert.Equal(t, float64(0), entry["bytes"])
+	assert.Equal(t, "10.0.0.1", entry["remote"])
+	assert.Contains(t, entry, "duration_ms")
+	assert.Contains(t, entry, "request_id")
+}
+
+func TestAccessLogHandler_LevelAndExclude(t *testing.T) {
+	logger := vlog.GetLogger("vloghttp/test/level")
+	capture := vlogtest.CaptureLogger(t, logger)
+	contextLogger := vlog.GetLogger("vloghttp/test/level/app")
+	contextCapture := vlogtest.CaptureLogger(t, contextLogger)
+	handler := NewAccessLogHandler(http.HandlerFunc(testHandler), logger)
+	handler.SetStatusLevel(2, vlog.Debug)
+	handler.SetStatusLevel(4, vlog.Off)
+	handler.SetExcludePaths("/health")
+	handler.SetContextLogger(contextLogger)
+	logger.SetLevel(vlog.Info)
+
+	serve(handler, httptest.NewRequest("GET", "/health", nil))
+	serve(handler, httptest.NewRequest("GET", "/hello", nil))
+	serve(handler, httptest.NewRequest("GET", "/missing", nil))
+	assert.Empty(t, capture.Records())
+	contextCapture.AssertCount(t, vlog.Info, "^handling$", 2)
+
+	assert.Panics(t, func() { handler.SetStatusLevel(6, vlog.Info) })
+}
+
+func TestRequestVariable(t *testing.T) {
+	RegisterRequestIDVariable("request_id")
+	// registered again by go test -count
+	assert.NotPanics(t, func() { RegisterRequestIDVariable("request_id") })
+	transformer := vlog.MustNewPatternTransformer("{request_id} {message}")
+	ctx := newContext(httptest.NewRequest("GET", "/", nil).Context(), nil, "req-2")
+	event := transformer.Transform(vlog.LogRecord{Message: "m", Context: ctx})
+	assert.Equal(t, "req-2 m", string(event.Message))
+	assert.Equal(t, defaultLogger, FromContext(ctx))
+}
@@ -0,0 +1,66 @@
+package vloghttp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hsiafan/vlog"
+)
+
+type contextKey struct{}
+
+// the values injected into request context by AccessLogHandler
+type contextValue struct {
+	logger    *vlog.Logger
+	requestID string
+}
+
+var defaultLogger = vlog.CurrentPackageLogger()
+
+// the names registered by RegisterRequestIDVariable
+var (
+	requestIDVariables     = map[string]bool{}
+	requestIDVariablesLock sync.Mutex
+)
+
+// RegisterRequestIDVariable register a PatternTransformer variable with name, such as "request_id", which output the
+// request id of context passed to logger. It should be called before creating transformers using it.
+// Registering the same name again does nothing; it panics if the name is registered by others,
+// as vlog.RegisterPatternVariable.
+func RegisterRequestIDVariable(name string) {
+	requestIDVariablesLock.Lock()
+	defer requestIDVariablesLock.Unlock()
+	if requestIDVariables[name] {
+		return
+	}
+	vlog.RegisterPatternVariable(name, func(record *vlog.LogRecord, arg string, buf *[]byte) {
+		if record.Context != nil {
+			*buf = append(*buf, RequestID(record.Context)...)
+		}
+	})
+	requestIDVariables[name] = true
+}
+
+func newContext(ctx context.Context, logger *vlog.Logger, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &contextValue{logger: logger, requestID: requestID})
+}
+
+// FromContext return the logger injected into request context by AccessLogHandler.
+// If there is no logger in ctx, the logger of vloghttp package is returned.
+// Pass the context to logger, to output the request id by the variable registered by RegisterRequestIDVariable:
+//
+//	vloghttp.FromContext(r.Context()).Info(r.Context(), "order created:", orderID)
+func FromContext(ctx context.Context) *vlog.Logger {
+	if value, ok := ctx.Value(contextKey{}).(*contextValue); ok && value.logger != nil {
+		return value.logger
+	}
+	return defaultLogger
+}
+
+// RequestID return the request id injected into request context by AccessLogHandler, or empty string if not found
+func RequestID(ctx context.Context) string {
+	if value, ok := ctx.Value(contextKey{}).(*contextValue); ok {
+		return value.requestID
+	}
+	return ""
+}
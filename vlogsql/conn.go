@@ -0,0 +1,213 @@
+package vlogsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+var _ driver.Conn = (*conn)(nil)
+var _ driver.ConnBeginTx = (*conn)(nil)
+var _ driver.ConnPrepareContext = (*conn)(nil)
+var _ driver.ExecerContext = (*conn)(nil)
+var _ driver.QueryerContext = (*conn)(nil)
+var _ driver.Pinger = (*conn)(nil)
+var _ driver.SessionResetter = (*conn)(nil)
+var _ driver.NamedValueChecker = (*conn)(nil)
+
+// conn wrap driver.Conn, log the statements executed
+type conn struct {
+	driver.Conn
+	driver *Driver
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var s driver.Stmt
+	var err error
+	start := time.Now()
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err = pc.PrepareContext(ctx, query)
+	} else {
+		s, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		c.driver.log(ctx, "prepare", query, nil, start, -1, err)
+		return nil, err
+	}
+	return &stmt{Stmt: s, query: query, driver: c.driver}, nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	var t driver.Tx
+	var err error
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		t, err = bc.BeginTx(ctx, opts)
+	} else if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		// same as database/sql does for drivers not supporting tx options
+		err = errors.New("sql: driver does not support non-default isolation level")
+	} else if opts.ReadOnly {
+		err = errors.New("sql: driver does not support read-only transactions")
+	} else {
+		t, err = c.Conn.Begin()
+	}
+	c.driver.log(ctx, "begin", "", nil, start, -1, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, ctx: ctx, driver: c.driver}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := ec.ExecContext(ctx, query, args)
+	c.driver.log(ctx, "exec", query, args, start, rowsAffected(result, err), err)
+	return result, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	c.driver.log(ctx, "query", query, args, start, -1, err)
+	return rows, err
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+var _ driver.Stmt = (*stmt)(nil)
+var _ driver.StmtExecContext = (*stmt)(nil)
+var _ driver.StmtQueryContext = (*stmt)(nil)
+
+// stmt wrap driver.Stmt, log the executions
+type stmt struct {
+	driver.Stmt
+	query  string
+	driver *Driver
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var result driver.Result
+	var err error
+	if ec, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = ec.ExecContext(ctx, args)
+	} else if values, convErr := plainValues(args); convErr != nil {
+		err = convErr
+	} else {
+		result, err = s.Stmt.Exec(values)
+	}
+	s.driver.log(ctx, "exec", s.query, args, start, rowsAffected(result, err), err)
+	return result, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if qc, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = qc.QueryContext(ctx, args)
+	} else if values, convErr := plainValues(args); convErr != nil {
+		err = convErr
+	} else {
+		rows, err = s.Stmt.Query(values)
+	}
+	s.driver.log(ctx, "query", s.query, args, start, -1, err)
+	return rows, err
+}
+
+// tx wrap driver.Tx, log commit and rollback
+type tx struct {
+	driver.Tx
+	ctx    context.Context
+	driver *Driver
+}
+
+func (t *tx) Commit() error {
+	start := time.Now()
+	err := t.Tx.Commit()
+	t.driver.log(t.ctx, "commit", "", nil, start, -1, err)
+	return err
+}
+
+func (t *tx) Rollback() error {
+	start := time.Now()
+	err := t.Tx.Rollback()
+	t.driver.log(t.ctx, "rollback", "", nil, start, -1, err)
+	return err
+}
+
+// rows affected of exec result, -1 if not available
+func rowsAffected(result driver.Result, err error) int64 {
+	if err != nil || result == nil {
+		return -1
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for idx, arg := range args {
+		values[idx] = driver.NamedValue{Ordinal: idx + 1, Value: arg}
+	}
+	return values
+}
+
+func plainValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for idx, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("vlogsql: driver does not support named args")
+		}
+		values[idx] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,182 @@
+// Package vlogsql provides a database/sql/driver wrapper, logging queries, args, durations, rows affected and errors
+// with vlog.
+package vlogsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/hsiafan/vlog"
+)
+
+// ArgRedactor return the value to log for query arg. The ordinal starts from 1, name is empty for positional args.
+type ArgRedactor func(ordinal int, name string, value interface{}) interface{}
+
+// RedactAllArgs is an ArgRedactor replacing all args with "***"
+func RedactAllArgs(ordinal int, name string, value interface{}) interface{} {
+	return "***"
+}
+
+var _ driver.Driver = (*Driver)(nil)
+var _ driver.DriverContext = (*Driver)(nil)
+
+// Driver wrap a sql driver, log the queries and execs with logger.
+// Successful statements are logged with Debug level, slow statements with Warn level, and failed ones with Error level.
+// The query, args, duration, rows affected and error are kept as fields of log record,
+// the context passed to database/sql methods is also passed to logger.
+type Driver struct {
+	driver        driver.Driver
+	logger        *vlog.Logger
+	slowThreshold time.Duration
+	redactor      ArgRedactor
+}
+
+// Wrap create a Driver wrapping d, logging with logger. Query args are redacted by RedactAllArgs by default.
+func Wrap(d driver.Driver, logger *vlog.Logger) *Driver {
+	return &Driver{driver: d, logger: logger, redactor: RedactAllArgs}
+}
+
+// Register wrap the registered driver with driverName, and register the wrapping driver with name.
+// Then use sql.Open(name, dsn) to open databases with logging. Return error if name is already registered.
+func Register(name string, driverName string, logger *vlog.Logger) (*Driver, error) {
+	for _, registered := range sql.Drivers() {
+		if registered == name {
+			return nil, errors.New("vlogsql: sql driver already registered: " + name)
+		}
+	}
+	db, err := sql.Open(driverName, "")
+	if err != nil {
+		return nil, err
+	}
+	d := Wrap(db.Driver(), logger)
+	_ = db.Close()
+	sql.Register(name, d)
+	return d, nil
+}
+
+// SetSlowThreshold set the duration threshold of slow statements, which are logged with Warn level.
+// Zero threshold disable slow statement detecting, which is the default.
+// This method should be called before driver start to work.
+func (d *Driver) SetSlowThreshold(threshold time.Duration) {
+	d.slowThreshold = threshold
+}
+
+// SetArgRedactor set the redactor to convert query args before logging, such as hiding passwords.
+// Default is RedactAllArgs, which hide all values; set nil to log args as they are.
+// This method should be called before driver start to work.
+func (d *Driver) SetArgRedactor(redactor ArgRedactor) {
+	d.redactor = redactor
+}
+
+// Open implement driver.Driver
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	c, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, driver: d}, nil
+}
+
+// OpenConnector implement driver.DriverContext
+func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.driver.(driver.DriverContext); ok {
+		c, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &connector{Connector: c, driver: d}, nil
+	}
+	return &connector{Connector: dsnConnector{name: name, driver: d.driver}, driver: d}, nil
+}
+
+type connector struct {
+	driver.Connector
+	driver *Driver
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dc, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: dc, driver: c.driver}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// connector for drivers not implementing driver.DriverContext
+type dsnConnector struct {
+	name   string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.name)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// log the statement. rowsAffected < 0 means not available.
+func (d *Driver) log(ctx context.Context, action string, query string, args []driver.NamedValue, start time.Time,
+	rowsAffected int64, err error) {
+	if err == driver.ErrSkip {
+		return
+	}
+	duration := time.Since(start)
+	level := vlog.Debug
+	if err != nil {
+		level = vlog.Error
+	} else if d.slowThreshold > 0 && duration >= d.slowThreshold {
+		level = vlog.Warn
+	}
+	if d.logger.Level() > level {
+		return
+	}
+
+	logArgs := make([]interface{}, 0, 8)
+	if ctx != nil {
+		logArgs = append(logArgs, ctx)
+	}
+	logArgs = append(logArgs, vlog.F("query", query))
+	if len(args) > 0 {
+		logArgs = append(logArgs, vlog.F("args", d.redactArgs(args)))
+	}
+	logArgs = append(logArgs, vlog.F("duration", duration))
+	if rowsAffected >= 0 {
+		logArgs = append(logArgs, vlog.F("rows_affected", rowsAffected))
+	}
+	if err != nil {
+		logArgs = append(logArgs, vlog.Err(err))
+	}
+	message := "sql " + action
+	if query != "" {
+		message += ": " + query
+	}
+	switch level {
+	case vlog.Error:
+		d.logger.Error(message, logArgs...)
+	case vlog.Warn:
+		d.logger.Warn(message, logArgs...)
+	default:
+		d.logger.Debug(message, logArgs...)
+	}
+}
+
+func (d *Driver) redactArgs(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for idx, arg := range args {
+		if d.redactor != nil {
+			values[idx] = d.redactor(arg.Ordinal, arg.Name, arg.Value)
+		} else {
+			values[idx] = arg.Value
+		}
+	}
+	return values
+}
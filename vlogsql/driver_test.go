@@ -0,0 +1,224 @@
+package vlogsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hsiafan/vlog"
+	"github.com/hsiafan/vlog/vlogtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fake driver for testing, statements containing "fail" fail, containing "invalid" fail to prepare,
+// containing "slow" sleep 20ms
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if strings.Contains(query, "invalid") {
+		if strings.Contains(query, "slow") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil, errors.New("syntax error")
+	}
+	return &fakeStmt{query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+type fakeStmt struct {
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) run() error {
+	if strings.Contains(s.query, "slow") {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if strings.Contains(s.query, "fail") {
+		return errors.New("table not found")
+	}
+	return nil
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.run(); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.run(); err != nil {
+		return nil, err
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	done bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+func init() {
+	sql.Register("vlogsql-fake", fakeDriver{})
+}
+
+func fields(record vlog.LogRecord) map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, field := range record.Fields {
+		values[field.Key] = field.Value
+	}
+	return values
+}
+
+var (
+	registerOnce sync.Once
+	registered   *Driver
+	registerErr  error
+)
+
+func TestDriver(t *testing.T) {
+	logger := vlog.GetLogger("vlogsql/test/driver")
+	capture := vlogtest.CaptureLogger(t, logger)
+	// registered once for go test -count
+	registerOnce.Do(func() {
+		registered, registerErr = Register("vlogsql-fake-logged", "vlogsql-fake", logger)
+	})
+	d := registered
+	assert.NoError(t, registerErr)
+	_, err := Register("vlogsql-fake-logged", "vlogsql-fake", logger)
+	assert.Error(t, err)
+	d.SetSlowThreshold(10 * time.Millisecond)
+	d.SetArgRedactor(func(ordinal int, name string, value interface{}) interface{} {
+		if ordinal == 2 {
+			return "***"
+		}
+		return value
+	})
+
+	db, err := sql.Open("vlogsql-fake-logged", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.WithValue(context.Background(), "k", "v")
+	result, err := db.ExecContext(ctx, "insert into user values(?, ?)", "alice", "secret")
+	assert.NoError(t, err)
+	n, _ := result.RowsAffected()
+	assert.Equal(t, int64(2), n)
+	records := capture.Find(vlog.Debug, `^sql exec: insert into user`)
+	if assert.Equal(t, 1, len(records)) {
+		values := fields(records[0])
+		assert.Equal(t, []interface{}{"alice", "***"}, values["args"])
+		assert.Equal(t, int64(2), values["rows_affected"])
+		assert.IsType(t, time.Duration(0), values["duration"])
+		assert.Equal(t, ctx, records[0].Context)
+	}
+
+	var id int
+	assert.NoError(t, db.QueryRow("select slow id from user").Scan(&id))
+	assert.Equal(t, 1, id)
+	capture.AssertContains(t, vlog.Warn, `^sql query: select slow id from user$`)
+
+	_, err = db.Exec("delete fail")
+	assert.Error(t, err)
+	records = capture.Find(vlog.Error, `^sql exec: delete fail$`)
+	if assert.Equal(t, 1, len(records)) {
+		assert.NotNil(t, fields(records[0])["error"])
+	}
+
+	_, err = db.Exec("invalid slow")
+	assert.Error(t, err)
+	records = capture.Find(vlog.Error, `^sql prepare: invalid slow$`)
+	if assert.Equal(t, 1, len(records)) {
+		assert.True(t, fields(records[0])["duration"].(time.Duration) >= 20*time.Millisecond)
+	}
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	capture.AssertContains(t, vlog.Debug, `^sql begin$`)
+	capture.AssertContains(t, vlog.Debug, `^sql commit$`)
+
+	// fake conn does not support tx options
+	_, err = db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	assert.Error(t, err)
+	_, err = db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	assert.Error(t, err)
+	capture.AssertCount(t, vlog.Error, `^sql begin$`, 2)
+}
+
+func TestDriver_Level(t *testing.T) {
+	logger := vlog.GetLogger("vlogsql/test/level")
+	capture := vlogtest.CaptureLogger(t, logger)
+	logger.SetLevel(vlog.Info)
+	db := sql.OpenDB(mustConnector(t, Wrap(fakeDriver{}, logger)))
+	defer db.Close()
+
+	_, err := db.Exec("update user set name = ?", "bob")
+	assert.NoError(t, err)
+	_, err = db.Exec("update fail", "bob")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"sql exec: update fail"}, capture.Messages())
+	// args are redacted by default
+	assert.Equal(t, []interface{}{"***"}, fields(capture.Records()[0])["args"])
+
+	assert.Equal(t, "***", RedactAllArgs(1, "", "secret"))
+}
+
+func mustConnector(t *testing.T, d *Driver) driver.Connector {
+	connector, err := d.OpenConnector("")
+	assert.NoError(t, err)
+	return connector
+}
@@ -0,0 +1,193 @@
+// Package vlogtest provides appenders and helpers for testing code logging with vlog.
+package vlogtest
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hsiafan/vlog"
+)
+
+var _ vlog.Appender = (*Capture)(nil)
+var _ vlog.Transformer = (*Capture)(nil)
+
+// Capture is an appender keeping all log records in memory, for assertions in tests.
+// Capture is also the transformer of itself, it records the LogRecord when transforming, the transformer can not be changed.
+type Capture struct {
+	lock    sync.Mutex
+	records []vlog.LogRecord
+}
+
+// NewCapture create capture appender
+func NewCapture() *Capture {
+	return &Capture{}
+}
+
+// Transform record the log record
+func (c *Capture) Transform(record vlog.LogRecord) vlog.AppendEvent {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.records = append(c.records, record)
+	return vlog.AppendEvent{LoggerName: record.LoggerName, Level: record.Level, Message: []byte(record.Message)}
+}
+
+// Append do nothing, the record is already kept when transforming
+func (c *Capture) Append(event vlog.AppendEvent) error {
+	return nil
+}
+
+// Transformer return the capture itself
+func (c *Capture) Transformer() vlog.Transformer {
+	return c
+}
+
+// SetTransformer not take effect for Capture
+func (c *Capture) SetTransformer(transformer vlog.Transformer) {
+}
+
+// Records return a copy of captured records
+func (c *Capture) Records() []vlog.LogRecord {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]vlog.LogRecord(nil), c.records...)
+}
+
+// Messages return messages of captured records
+func (c *Capture) Messages() []string {
+	var messages []string
+	for _, record := range c.Records() {
+		messages = append(messages, record.Message)
+	}
+	return messages
+}
+
+// Reset clear captured records
+func (c *Capture) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.records = nil
+}
+
+// Find return records at level, with message matching the regular expression pattern
+func (c *Capture) Find(level vlog.Level, pattern string) []vlog.LogRecord {
+	re := regexp.MustCompile(pattern)
+	var found []vlog.LogRecord
+	for _, record := range c.Records() {
+		if record.Level == level && re.MatchString(record.Message) {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+// AssertContains assert there is a record at level, with message matching the regular expression pattern
+func (c *Capture) AssertContains(t testing.TB, level vlog.Level, pattern string) bool {
+	t.Helper()
+	if len(c.Find(level, pattern)) == 0 {
+		t.Errorf("no %s log with message matching %q, captured logs:\n%s", level.Name(), pattern, c.dump())
+		return false
+	}
+	return true
+}
+
+// AssertNotContains assert there is no record at level, with message matching the regular expression pattern
+func (c *Capture) AssertNotContains(t testing.TB, level vlog.Level, pattern string) bool {
+	t.Helper()
+	if found := c.Find(level, pattern); len(found) > 0 {
+		t.Errorf("unexpected %s log with message matching %q: %s", level.Name(), pattern, found[0].Message)
+		return false
+	}
+	return true
+}
+
+// AssertCount assert the number of records at level, with message matching the regular expression pattern
+func (c *Capture) AssertCount(t testing.TB, level vlog.Level, pattern string, count int) bool {
+	t.Helper()
+	if found := c.Find(level, pattern); len(found) != count {
+		t.Errorf("expect %d %s logs with message matching %q, got %d, captured logs:\n%s",
+			count, level.Name(), pattern, len(found), c.dump())
+		return false
+	}
+	return true
+}
+
+func (c *Capture) dump() string {
+	var sb strings.Builder
+	for _, record := range c.Records() {
+		sb.WriteString("\t[")
+		sb.WriteString(record.Level.Name())
+		sb.WriteString("] ")
+		sb.WriteString(record.LoggerName)
+		sb.WriteString(" - ")
+		sb.WriteString(record.Message)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// CaptureLogger set a new Capture as the only appender of logger, and set logger level to Trace,
+// for the duration of the test. The origin appenders and level are restored when test finished.
+// If the level of logger is fixed by VLOG_LEVEL env, it can not be set to Trace, and the test fails,
+// as records below the level would not be captured.
+func CaptureLogger(t testing.TB, logger *vlog.Logger) *Capture {
+	capture := NewCapture()
+	install(t, logger, capture)
+	return capture
+}
+
+// CapturePrefix set a new Capture as the only appender of all loggers matching the prefix, and set their level to Trace,
+// for the duration of the test. Only loggers already created are affected.
+// The origin appenders and levels are restored when test finished. The test fails if any logger level is fixed
+// by VLOG_LEVEL env, as CaptureLogger.
+func CapturePrefix(t testing.TB, prefix string) *Capture {
+	capture := NewCapture()
+	for _, logger := range vlog.FilterLoggers(prefix) {
+		install(t, logger, capture)
+	}
+	return capture
+}
+
+// LogToTest set a TestAppender as the only appender of logger, for the duration of the test,
+// so the logs are output by t.Log, and attached to the test.
+// The origin appenders are restored when test finished. The test fails if the logger level is fixed
+// by VLOG_LEVEL env, as CaptureLogger.
+func LogToTest(t testing.TB, logger *vlog.Logger) {
+	install(t, logger, NewTestAppender(t))
+}
+
+func install(t testing.TB, logger *vlog.Logger, appender vlog.Appender) {
+	appenders := logger.Appenders()
+	level := logger.Level()
+	t.Cleanup(func() {
+		logger.SetAppenders(appenders...)
+		logger.SetLevel(level)
+	})
+	logger.SetAppenders(appender)
+	logger.SetLevel(vlog.Trace)
+	if logger.Level() != vlog.Trace {
+		t.Helper()
+		t.Errorf("vlogtest: level of logger %q is fixed to %s by VLOG_LEVEL env, records below it are not captured",
+			logger.Name(), logger.Level().Name())
+	}
+}
+
+var _ vlog.Appender = (*TestAppender)(nil)
+
+// TestAppender write logs by t.Log, so log output is attached to the test, and only shown when test failed or -v is set.
+type TestAppender struct {
+	*vlog.CanFormattedMixin
+	t testing.TB
+}
+
+// NewTestAppender create test appender
+func NewTestAppender(t testing.TB) *TestAppender {
+	return &TestAppender{CanFormattedMixin: vlog.NewAppenderMixin(), t: t}
+}
+
+// Append write log by t.Log
+func (ta *TestAppender) Append(event vlog.AppendEvent) error {
+	ta.t.Log(strings.TrimRight(string(event.Message), "\n"))
+	return nil
+}
@@ -0,0 +1,58 @@
+package vlogtest
+
+import (
+	"testing"
+
+	"github.com/hsiafan/vlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureLogger(t *testing.T) {
+	logger := vlog.GetLogger("vlogtest/capture")
+	origin := vlog.NewNopAppender()
+	logger.SetAppenders(origin)
+
+	t.Run("capture", func(t *testing.T) {
+		capture := CaptureLogger(t, logger)
+		logger.Debug("debug message")
+		logger.ErrorFormat("request {} failed", 10, vlog.F("code", 500))
+
+		assert.Equal(t, []string{"debug message", "request 10 failed"}, capture.Messages())
+		capture.AssertContains(t, vlog.Error, `request \d+ failed`)
+		capture.AssertNotContains(t, vlog.Info, "request")
+		capture.AssertCount(t, vlog.Debug, "message$", 1)
+		records := capture.Find(vlog.Error, "failed")
+		assert.Equal(t, []vlog.Field{vlog.F("code", 500)}, records[0].Fields)
+		assert.Equal(t, "vlogtest/capture", records[0].LoggerName)
+
+		capture.Reset()
+		assert.Equal(t, 0, len(capture.Records()))
+	})
+
+	assert.Equal(t, []vlog.Appender{origin}, logger.Appenders())
+	assert.Equal(t, vlog.DefaultLevel, logger.Level())
+}
+
+func TestCapturePrefix(t *testing.T) {
+	logger1 := vlog.GetLogger("vlogtest/prefix/logger1")
+	logger2 := vlog.GetLogger("vlogtest/prefix/logger2")
+	logger3 := vlog.GetLogger("vlogtest/other")
+
+	t.Run("capture", func(t *testing.T) {
+		capture := CapturePrefix(t, "vlogtest/prefix")
+		logger1.Info("message1")
+		logger2.Trace("message2")
+		logger3.Info("message3")
+		assert.Equal(t, []string{"message1", "message2"}, capture.Messages())
+	})
+
+	assert.Equal(t, []vlog.Appender{vlog.DefaultAppender()}, logger1.Appenders())
+	assert.Equal(t, vlog.DefaultLevel, logger2.Level())
+}
+
+func TestLogToTest(t *testing.T) {
+	logger := vlog.GetLogger("vlogtest/to_test")
+	LogToTest(t, logger)
+	assert.IsType(t, &TestAppender{}, logger.Appenders()[0])
+	logger.Info("this message is attached to test output")
+}